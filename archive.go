@@ -0,0 +1,652 @@
+package spec
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ArchiveTarGz  = "tar.gz"
+	ArchiveTarZst = "tar.zst"
+	ArchiveZip    = "zip"
+)
+
+// ArchiveSpec extracts an archive into a directory of the project.
+type ArchiveSpec struct {
+	// archive to extract; relative to the project path, or a name in FS
+	Source string `yaml:"source"`
+
+	// optional filesystem containing Source (e.g. an embed.FS)
+	FS fs.FS `yaml:"-"`
+
+	// destination directory, relative to the project path
+	Dest string `yaml:"dest"`
+
+	// archive format; inferred from the Source extension if empty
+	Format string `yaml:"format"`
+
+	// manifest recording the extracted files; defaults to a hidden file in Dest
+	Manifest string `yaml:"manifest"`
+}
+
+// ArchiveManifest records the checksum of an archive and the files extracted from it.
+type ArchiveManifest struct {
+	Archive string            `json:"archive"`
+	Files   map[string]string `json:"files"`
+	Dirs    []string          `json:"dirs,omitempty"`
+}
+
+// a single entry read from an archive
+type archiveEntry struct {
+	Name     string
+	Mode     fs.FileMode
+	Linkname string
+	Body     io.Reader
+}
+
+func (s *ArchiveSpec) Check(project *Project) (bool, error) {
+	manifest, err := s.readManifest(project)
+	if err != nil || manifest == nil {
+		return false, err
+	}
+
+	data, err := s.readSource(project)
+	if err != nil {
+		return false, err
+	}
+
+	if manifest.Archive != checksum(data) {
+		log.Debug().Str("project", project.Name).Str("archive", s.Source).Msg("Archive checksum changed")
+		return false, nil
+	}
+
+	fsys, dest, err := project.ResolveFS(s.Dest)
+	if err != nil {
+		return false, err
+	}
+
+	for name, sum := range manifest.Files {
+		current, err := fileChecksum(fsys, path.Join(dest, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		if current != sum {
+			log.Debug().Str("project", project.Name).Str("file", name).Msg("Extracted file changed")
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (s *ArchiveSpec) Apply(project *Project) error {
+	fsys, dest, err := project.ResolveFS(s.Dest)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.readSource(project)
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.readManifest(project)
+	if err != nil {
+		return err
+	}
+
+	manifest := &ArchiveManifest{
+		Archive: checksum(data),
+		Files:   make(map[string]string),
+	}
+
+	if err := fsys.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+
+	// on the host, the OS also keeps the extraction inside dest
+	target, root := fsys, dest
+	if project.FS == nil {
+		hostDest, err := project.ResolvePath(s.Dest)
+		if err != nil {
+			return err
+		}
+
+		rootFS, err := NewRootFS(hostDest)
+		if err != nil {
+			return err
+		}
+		defer rootFS.Close()
+
+		target, root = rootFS, "."
+	}
+
+	err = s.entries(data, func(entry *archiveEntry) error {
+		return extractEntry(target, root, entry, manifest)
+	})
+	if err != nil {
+		return err
+	}
+
+	// clean up files from a previous extraction that are no longer in the archive
+	if previous != nil {
+		stale := &ArchiveManifest{Files: make(map[string]string)}
+		for name, sum := range previous.Files {
+			if _, ok := manifest.Files[name]; !ok {
+				stale.Files[name] = sum
+			}
+		}
+		for _, dir := range previous.Dirs {
+			if !slices.Contains(manifest.Dirs, dir) {
+				stale.Dirs = append(stale.Dirs, dir)
+			}
+		}
+		if err := removeManifestFiles(fsys, dest, stale); err != nil {
+			return err
+		}
+	}
+
+	return s.writeManifest(project, manifest)
+}
+
+func (s *ArchiveSpec) Exists(project *Project) (bool, error) {
+	manifest, err := s.readManifest(project)
+	return manifest != nil, err
+}
+
+func (s *ArchiveSpec) Remove(project *Project) error {
+	manifest, err := s.readManifest(project)
+	if err != nil || manifest == nil {
+		return err
+	}
+
+	fsys, dest, err := project.ResolveFS(s.Dest)
+	if err != nil {
+		return err
+	}
+
+	if err := removeManifestFiles(fsys, dest, manifest); err != nil {
+		return err
+	}
+
+	mfs, name, err := s.manifestFS(project)
+	if err != nil {
+		return err
+	}
+
+	return mfs.Remove(name)
+}
+
+// record what Apply may change so a failed transaction can restore it: the
+// files of the previous extraction, the entries of the archive and the
+// manifest.  the rest of the destination is left out, since it may be the
+// whole project.
+func (s *ArchiveSpec) Snapshot(project *Project) (Snapshot, error) {
+	fsys, dest, err := project.ResolveFS(s.Dest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.readSource(project)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := s.readManifest(project)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	if _, err := fsys.Lstat(dest); err != nil {
+		names = append(names, newSnapshotName(fsys, dest))
+	}
+
+	if previous != nil {
+		for name := range previous.Files {
+			names = append(names, path.Join(dest, name))
+		}
+		for _, dir := range previous.Dirs {
+			names = append(names, path.Join(dest, dir))
+		}
+	}
+
+	err = s.entries(data, func(entry *archiveEntry) error {
+		name := strings.TrimSuffix(path.Clean(filepath.ToSlash(entry.Name)), "/")
+		if name == "" || name == "." || !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil
+		}
+
+		// existing directories are never changed, so only new ones are recorded
+		target := newSnapshotName(fsys, path.Join(dest, name))
+		if _, err := fsys.Lstat(target); err != nil || !entry.Mode.IsDir() {
+			names = append(names, target)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(names)
+	snapshot, err := SnapshotFS(fsys, slices.Compact(names)...)
+	if err != nil {
+		return nil, err
+	}
+
+	mfs, name, err := s.manifestFS(project)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := SnapshotFS(mfs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots{snapshot, manifest}, nil
+}
+
+// the destination, so a new source replaces the previous extraction rather
+// than pruning it; see IdentifiableSpec
+func (s *ArchiveSpec) Resource() string {
+	return s.Dest
+}
+
+func (s *ArchiveSpec) String() string {
+	return describeFields("archive", s.Source, s.Dest)
+}
+
+// determine the archive format from the spec or source extension
+func (s *ArchiveSpec) format() (string, error) {
+	if s.Format != "" {
+		return s.Format, nil
+	}
+
+	name := strings.ToLower(s.Source)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, nil
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return ArchiveTarZst, nil
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip, nil
+	}
+
+	return "", fmt.Errorf("unknown archive format: %s", s.Source)
+}
+
+// read the entire source archive
+func (s *ArchiveSpec) readSource(project *Project) ([]byte, error) {
+	if s.FS != nil {
+		return fs.ReadFile(s.FS, s.Source)
+	}
+
+	fsys, name, err := project.ResolveFS(s.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	return fsys.ReadFile(name)
+}
+
+// iterate over the entries in the archive
+func (s *ArchiveSpec) entries(data []byte, fn func(*archiveEntry) error) error {
+	format, err := s.format()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ArchiveTarGz:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return tarEntries(reader, fn)
+
+	case ArchiveTarZst:
+		reader, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return tarEntries(reader, fn)
+
+	case ArchiveZip:
+		return zipEntries(data, fn)
+	}
+
+	return fmt.Errorf("unsupported archive format: %s", format)
+}
+
+func (s *ArchiveSpec) manifestFS(project *Project) (WritableFS, string, error) {
+	if s.Manifest != "" {
+		return project.ResolveFS(s.Manifest)
+	}
+
+	name := "." + path.Base(filepath.ToSlash(s.Source)) + ".manifest.json"
+	return project.ResolveFS(filepath.Join(s.Dest, name))
+}
+
+// read the manifest from a previous extraction; returns nil if there is none
+func (s *ArchiveSpec) readManifest(project *Project) (*ArchiveManifest, error) {
+	fsys, name, err := s.manifestFS(project)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fsys.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	manifest := &ArchiveManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid archive manifest %s: %w", name, err)
+	}
+
+	return manifest, nil
+}
+
+func (s *ArchiveSpec) writeManifest(project *Project, manifest *ArchiveManifest) error {
+	fsys, name, err := s.manifestFS(project)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fsys.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	return fsys.WriteFile(name, data, 0o644)
+}
+
+func tarEntries(reader io.Reader, fn func(*archiveEntry) error) error {
+	tr := tar.NewReader(reader)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		entry := &archiveEntry{Name: header.Name, Body: tr}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entry.Mode = fs.ModeDir | fs.FileMode(header.Mode).Perm()
+		case tar.TypeReg:
+			entry.Mode = fs.FileMode(header.Mode).Perm()
+		case tar.TypeSymlink:
+			entry.Mode = fs.ModeSymlink
+			entry.Linkname = header.Linkname
+		default:
+			log.Warn().Str("entry", header.Name).Msg("Skipping unsupported archive entry")
+			continue
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func zipEntries(data []byte, fn func(*archiveEntry) error) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zr.File {
+		entry := &archiveEntry{Name: file.Name, Mode: file.Mode()}
+
+		if entry.Mode&fs.ModeType & ^(fs.ModeDir|fs.ModeSymlink) != 0 {
+			log.Warn().Str("entry", file.Name).Msg("Skipping unsupported archive entry")
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode&fs.ModeSymlink != 0 {
+			link, err := io.ReadAll(reader)
+			if err != nil {
+				reader.Close()
+				return err
+			}
+			entry.Linkname = string(link)
+		}
+
+		entry.Body = reader
+		err = fn(entry)
+		reader.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write a single archive entry below dest and record it in the manifest
+func extractEntry(fsys WritableFS, dest string, entry *archiveEntry, manifest *ArchiveManifest) error {
+	name := strings.TrimSuffix(path.Clean(filepath.ToSlash(entry.Name)), "/")
+	if name == "" || name == "." {
+		return nil
+	}
+
+	if !filepath.IsLocal(filepath.FromSlash(entry.Name)) {
+		return fmt.Errorf("archive entry escapes destination: %s", entry.Name)
+	}
+
+	target := path.Join(dest, name)
+
+	// entries may be written through links extracted earlier, so the parent
+	// is checked against the links that are on disk now
+	links := &destLinks{fsys: fsys, dest: dest}
+	if err := checkSymlinks(links, path.Dir(name), links.abs); err != nil {
+		return fmt.Errorf("archive entry escapes destination: %s", entry.Name)
+	}
+
+	if err := mkdirRecorded(fsys, dest, path.Dir(name), manifest); err != nil {
+		return err
+	}
+
+	switch {
+	case entry.Mode.IsDir():
+		return mkdirRecorded(fsys, dest, name, manifest)
+
+	case entry.Mode&fs.ModeSymlink != 0:
+		link := path.Dir(name) + "/" + filepath.ToSlash(entry.Linkname)
+		if path.IsAbs(filepath.ToSlash(entry.Linkname)) || checkSymlinks(links, link, links.abs) != nil {
+			return fmt.Errorf("archive symlink escapes destination: %s -> %s", entry.Name, entry.Linkname)
+		}
+
+		if err := removeExisting(fsys, target); err != nil {
+			return err
+		}
+
+		if err := fsys.Symlink(entry.Linkname, target); err != nil {
+			return err
+		}
+
+		manifest.Files[name] = "symlink:" + entry.Linkname
+		return nil
+	}
+
+	// never write through an existing symlink
+	if err := removeExisting(fsys, target); err != nil {
+		return err
+	}
+
+	mode := entry.Mode.Perm()
+	if mode == 0 {
+		mode = 0o644
+	}
+
+	data, err := io.ReadAll(entry.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := fsys.WriteFile(target, data, mode); err != nil {
+		return err
+	}
+
+	manifest.Files[name] = checksum(data)
+	return nil
+}
+
+// the links below dest, as seen from dest; absolute targets are never
+// followed
+type destLinks struct {
+	fsys WritableFS
+	dest string
+}
+
+func (d *destLinks) Lstat(name string) (fs.FileInfo, error) {
+	return d.fsys.Lstat(path.Join(d.dest, name))
+}
+
+func (d *destLinks) ReadLink(name string) (string, error) {
+	return d.fsys.ReadLink(path.Join(d.dest, name))
+}
+
+func (d *destLinks) abs(string) (string, bool) {
+	return "", false
+}
+
+// create a directory (and parents) below dest, recording the ones created
+func mkdirRecorded(fsys WritableFS, dest, name string, manifest *ArchiveManifest) error {
+	if name == "." {
+		return nil
+	}
+
+	if _, err := fsys.Lstat(path.Join(dest, name)); err == nil {
+		return nil
+	}
+
+	if err := mkdirRecorded(fsys, dest, path.Dir(name), manifest); err != nil {
+		return err
+	}
+
+	err := fsys.Mkdir(path.Join(dest, name), 0o755)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	manifest.Dirs = append(manifest.Dirs, name)
+	return nil
+}
+
+// the outermost parent of name that does not exist yet, so a snapshot also
+// removes the directories created for it; name itself if its parent exists
+func newSnapshotName(fsys WritableFS, name string) string {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, err := fsys.Lstat(dir); err == nil {
+			break
+		}
+		name = dir
+	}
+	return name
+}
+
+// remove the files in the manifest, then any directories that are left empty
+func removeManifestFiles(fsys WritableFS, dest string, manifest *ArchiveManifest) error {
+	for name := range manifest.Files {
+		err := fsys.Remove(path.Join(dest, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	// remove the deepest directories first
+	dirs := slices.Clone(manifest.Dirs)
+	slices.SortFunc(dirs, func(a, b string) int {
+		return strings.Count(b, "/") - strings.Count(a, "/")
+	})
+
+	for _, dir := range dirs {
+		name := path.Join(dest, dir)
+		if entries, err := fsys.ReadDir(name); err == nil && len(entries) == 0 {
+			if err := fsys.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func removeExisting(fsys WritableFS, name string) error {
+	info, err := fsys.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("cannot replace directory with file: %s", name)
+	}
+
+	return fsys.Remove(name)
+}
+
+// checksum of a file as recorded in the manifest; symlinks record their target
+func fileChecksum(fsys WritableFS, name string) (string, error) {
+	info, err := fsys.Lstat(name)
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := fsys.ReadLink(name)
+		return "symlink:" + target, err
+	}
+
+	content, err := fsys.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	return checksum(content), nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
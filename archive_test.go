@@ -0,0 +1,409 @@
+package spec
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestArchiveSpec(t *testing.T) {
+	files := map[string]string{
+		"assets/logo.svg":     "<svg/>",
+		"assets/css/site.css": "body {}",
+		"README.md":           "# assets",
+	}
+
+	formats := []struct {
+		name  string
+		build func(*testing.T, map[string]string) []byte
+	}{
+		{name: "vendor.tar.gz", build: buildTestTarGz},
+		{name: "vendor.tar.zst", build: buildTestTarZst},
+		{name: "vendor.zip", build: buildTestZip},
+	}
+
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			dir := t.TempDir()
+			data := format.build(t, files)
+			if err := os.WriteFile(filepath.Join(dir, format.name), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			spec := &ArchiveSpec{Source: format.name, Dest: "vendor"}
+			project := NewProject("test").WithPath(dir).WithSpec(spec).Build()
+
+			ok, err := spec.Check(project)
+			if err != nil {
+				t.Fatalf("Check failed: %v", err)
+			}
+
+			if ok {
+				t.Fatal("expected Check to return false before extraction")
+			}
+
+			if err := project.BuildAll(); err != nil {
+				t.Fatalf("BuildAll failed: %v", err)
+			}
+
+			for name, content := range files {
+				data, err := os.ReadFile(filepath.Join(dir, "vendor", name))
+				if err != nil {
+					t.Fatalf("expected %s to be extracted: %v", name, err)
+				}
+				if string(data) != content {
+					t.Fatalf("unexpected content for %s: %q", name, data)
+				}
+			}
+
+			ok, err = spec.Check(project)
+			if err != nil {
+				t.Fatalf("Check failed: %v", err)
+			}
+
+			if !ok {
+				t.Fatal("expected Check to return true after extraction")
+			}
+		})
+	}
+}
+
+func TestArchiveSpecFromFS(t *testing.T) {
+	data := buildTestTarGz(t, map[string]string{"config.yaml": "key: value"})
+	fsys := fstest.MapFS{"bundle.tgz": &fstest.MapFile{Data: data}}
+
+	dir := t.TempDir()
+	spec := &ArchiveSpec{Source: "bundle.tgz", FS: fsys, Dest: "conf"}
+	project := NewProject("test").WithPath(dir).Build()
+
+	if err := spec.Apply(project); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "conf", "config.yaml")); err != nil {
+		t.Fatal("expected config.yaml to be extracted")
+	}
+}
+
+func TestArchiveSpecMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	data := buildTestZip(t, map[string]string{"docs/index.md": "# docs"})
+	if err := fsys.WriteFile("docs.zip", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &ArchiveSpec{Source: "docs.zip", Dest: "site"}
+	project := NewProject("test").WithFS(fsys).WithSpec(spec).Build()
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	content, err := fsys.ReadFile("site/docs/index.md")
+	if err != nil {
+		t.Fatalf("expected file to be extracted: %v", err)
+	}
+
+	if string(content) != "# docs" {
+		t.Fatalf("unexpected content %q", content)
+	}
+
+	if ok, _ := spec.Check(project); !ok {
+		t.Fatal("expected Check to return true after extraction")
+	}
+
+	if err := spec.Remove(project); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	entries, err := fsys.ReadDir("site")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expected site to be empty, got %d entries", len(entries))
+	}
+}
+
+func TestArchiveSpecDrift(t *testing.T) {
+	dir := t.TempDir()
+	data := buildTestTarGz(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	if err := os.WriteFile(filepath.Join(dir, "src.tar.gz"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &ArchiveSpec{Source: "src.tar.gz", Dest: "out"}
+	project := NewProject("test").WithPath(dir).Build()
+
+	if err := spec.Apply(project); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	t.Run("modified file", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "out", "a.txt"), []byte("changed"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, _ := spec.Check(project); ok {
+			t.Fatal("expected Check to detect modified file")
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		if ok, _ := spec.Check(project); !ok {
+			t.Fatal("expected Check to return true after re-apply")
+		}
+	})
+
+	t.Run("changed archive removes stale files", func(t *testing.T) {
+		data := buildTestTarGz(t, map[string]string{"a.txt": "a"})
+		if err := os.WriteFile(filepath.Join(dir, "src.tar.gz"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, _ := spec.Check(project); ok {
+			t.Fatal("expected Check to detect changed archive")
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "out", "b.txt")); !os.IsNotExist(err) {
+			t.Fatal("expected stale file to be removed")
+		}
+	})
+}
+
+func TestArchiveSpecRemove(t *testing.T) {
+	dir := t.TempDir()
+	data := buildTestZip(t, map[string]string{"lib/x.js": "x", "lib/y/z.js": "z"})
+	if err := os.WriteFile(filepath.Join(dir, "lib.zip"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file not owned by the archive must survive removal
+	if err := os.MkdirAll(filepath.Join(dir, "web", "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "web", "lib", "local.js"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &ArchiveSpec{Source: "lib.zip", Dest: "web"}
+	project := NewProject("test").WithPath(dir).WithSpecPresent(spec).Build()
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	project = NewProject("test").WithPath(dir).WithSpecRemove(spec).Build()
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "web", "lib", "x.js")); !os.IsNotExist(err) {
+		t.Fatal("expected extracted file to be removed")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "web", "lib", "y")); !os.IsNotExist(err) {
+		t.Fatal("expected extracted directory to be removed")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "web", "lib", "local.js")); err != nil {
+		t.Fatal("expected unrelated file to remain")
+	}
+
+	if exists, _ := spec.Exists(project); exists {
+		t.Fatal("expected manifest to be removed")
+	}
+}
+
+func TestArchiveSpecTraversal(t *testing.T) {
+	testCases := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{
+			name:    "parent path",
+			entries: []tar.Header{{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0o644}},
+		},
+		{
+			name:    "absolute path",
+			entries: []tar.Header{{Name: "/tmp/evil.txt", Typeflag: tar.TypeReg, Mode: 0o644}},
+		},
+		{
+			name:    "escaping symlink",
+			entries: []tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}},
+		},
+		{
+			name:    "absolute symlink",
+			entries: []tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+		},
+		{
+			// e resolves through d/l, which points back at dest
+			name: "chained symlinks",
+			entries: []tar.Header{
+				{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "e", Typeflag: tar.TypeSymlink, Linkname: "d/l/.."},
+				{Name: "e/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+			},
+		},
+		{
+			name: "link target through chained symlinks",
+			entries: []tar.Header{
+				{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "d/l/x/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+				{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "d/l/d/l/.."},
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			for _, header := range tt.entries {
+				if err := tw.WriteHeader(&header); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tw.Close()
+			gz.Close()
+
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "evil.tgz"), buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			memfs := NewMemFS()
+			if err := memfs.WriteFile("evil.tgz", buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			spec := &ArchiveSpec{Source: "evil.tgz", Dest: "out"}
+
+			for _, project := range []*Project{
+				NewProject("test").WithPath(dir).Build(),
+				NewProject("test").WithFS(memfs).Build(),
+			} {
+				err := spec.Apply(project)
+				if err == nil {
+					t.Fatal("expected error for unsafe entry")
+				}
+
+				if !strings.Contains(err.Error(), "escapes destination") {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if _, err := os.Lstat(filepath.Join(dir, "evil")); err == nil {
+				t.Fatal("expected nothing to be written outside the destination")
+			}
+		})
+	}
+}
+
+func TestArchiveSpecUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.rar"), []byte("rar"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &ArchiveSpec{Source: "data.rar", Dest: "out"}
+	project := NewProject("test").WithPath(dir).Build()
+
+	if err := spec.Apply(project); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+// Test helpers
+
+func writeTestTar(t *testing.T, w io.Writer, files map[string]string) {
+	t.Helper()
+
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		header := &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func buildTestTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writeTestTar(t, gz, files)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func buildTestTarZst(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestTar(t, zw, files)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func buildTestZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
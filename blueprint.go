@@ -1,34 +1,203 @@
 package spec
 
 import (
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/rs/zerolog/log"
 )
 
 type Blueprint struct {
-	Name  string
-	Specs []Specification
+	Name        string
+	Description string
+	Specs       []Specification
+
+	// tags added to each spec when the blueprint is used
+	Tags []string
+
+	// applies the blueprint automatically to projects whose facts match; see
+	// BlueprintRegistry.Match
+	Selector *Selector
 }
 
 type BlueprintRegistry struct {
 	lock       sync.RWMutex
-	blueprints map[string]*Blueprint
+	blueprints map[string]*blueprintEntry
+	policy     DuplicatePolicy
+}
+
+// BlueprintInfo describes a registered blueprint.
+type BlueprintInfo struct {
+	Name        string
+	Description string
+
+	// prefix of a namespaced name, e.g. acme for acme/base
+	Namespace string
+
+	// number of specs in the blueprint
+	Specs int
+
+	// facts selector of the blueprint, if any
+	Selector string
+
+	// import path of the package that registered the blueprint
+	Package string
 }
 
 type BlueprintBuilder struct {
 	blueprint *Blueprint
 }
 
-var blueprintRegistry = &BlueprintRegistry{
-	blueprints: make(map[string]*Blueprint),
+type blueprintEntry struct {
+	blueprint *Blueprint
+	pkg       string
+	location  string
+}
+
+func newBlueprintRegistry() *BlueprintRegistry {
+	return &BlueprintRegistry{blueprints: make(map[string]*blueprintEntry)}
 }
 
-func RegisterBlueprint(bp *Blueprint) {
+// the blueprints in the default registry
+func Blueprints() *BlueprintRegistry {
+	return defaultRegistry.Blueprints
+}
+
+// add a blueprint to the default registry; see BlueprintRegistry.Register
+func RegisterBlueprint(bp *Blueprint) error {
+	return defaultRegistry.Blueprints.register(bp, callerPackage(1), callerLocation(1))
+}
+
+// return a blueprint by name from the default registry
+func GetBlueprint(name string) (*Blueprint, bool) {
+	return defaultRegistry.Blueprints.Get(name)
+}
+
+// return the sorted names of all blueprints in the default registry
+func ListBlueprints() []string {
+	return defaultRegistry.Blueprints.List()
+}
+
+// set how blueprints registered under an existing name are handled
+func (r *BlueprintRegistry) SetDuplicatePolicy(policy DuplicatePolicy) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.policy = policy
+}
+
+// add a blueprint; names may be namespaced, e.g. acme/base.  duplicate names
+// are handled by the registry's duplicate policy.
+func (r *BlueprintRegistry) Register(bp *Blueprint) error {
+	return r.register(bp, callerPackage(1), callerLocation(1))
+}
+
+func (r *BlueprintRegistry) register(bp *Blueprint, pkg, location string) error {
 	log.Trace().Str("blueprint", bp.Name).Msg("Registering blueprint")
-	blueprintRegistry.lock.Lock()
-	defer blueprintRegistry.lock.Unlock()
-	blueprintRegistry.blueprints[bp.Name] = bp
+
+	if err := validateName("blueprint", bp.Name); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if existing, ok := r.blueprints[bp.Name]; ok {
+		duplicate := &DuplicateNameError{Type: "blueprint", Name: bp.Name, Location: location, Existing: existing.location}
+		if err := r.policy.resolve(duplicate); err != nil {
+			return err
+		}
+	}
+
+	r.blueprints[bp.Name] = &blueprintEntry{blueprint: bp, pkg: pkg, location: location}
+	return nil
+}
+
+// remove a blueprint; returns false if it was not registered
+func (r *BlueprintRegistry) Unregister(name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, ok := r.blueprints[name]
+	delete(r.blueprints, name)
+	return ok
+}
+
+func (r *BlueprintRegistry) Get(name string) (*Blueprint, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.blueprints[name]
+	if !ok {
+		return nil, false
+	}
+	return entry.blueprint, true
+}
+
+func (r *BlueprintRegistry) Has(name string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.blueprints[name]
+	return ok
+}
+
+// return the metadata for a blueprint
+func (r *BlueprintRegistry) Info(name string) (BlueprintInfo, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.blueprints[name]
+	if !ok {
+		return BlueprintInfo{}, false
+	}
+	return entry.info(), true
+}
+
+// return the sorted names of all registered blueprints
+func (r *BlueprintRegistry) List() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return slices.Sorted(maps.Keys(r.blueprints))
+}
+
+// return the metadata for all registered blueprints, sorted by name
+func (r *BlueprintRegistry) Infos() []BlueprintInfo {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	infos := []BlueprintInfo{}
+	for _, name := range slices.Sorted(maps.Keys(r.blueprints)) {
+		infos = append(infos, r.blueprints[name].info())
+	}
+	return infos
+}
+
+// return the blueprints whose selectors match the facts, sorted by name;
+// blueprints without a selector are never matched
+func (r *BlueprintRegistry) Match(facts map[string]string) []*Blueprint {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	matched := []*Blueprint{}
+	for _, name := range slices.Sorted(maps.Keys(r.blueprints)) {
+		bp := r.blueprints[name].blueprint
+		if bp.Selector != nil && bp.Selector.MatchesFacts(facts) {
+			matched = append(matched, bp)
+		}
+	}
+	return matched
+}
+
+func (e *blueprintEntry) info() BlueprintInfo {
+	namespace, _ := SplitName(e.blueprint.Name)
+	return BlueprintInfo{
+		Name:        e.blueprint.Name,
+		Description: e.blueprint.Description,
+		Namespace:   namespace,
+		Specs:       len(e.blueprint.Specs),
+		Selector:    e.blueprint.Selector.String(),
+		Package:     e.pkg,
+	}
 }
 
 func NewBlueprint(name string) *BlueprintBuilder {
@@ -40,13 +209,30 @@ func NewBlueprint(name string) *BlueprintBuilder {
 	}
 }
 
+func (b *BlueprintBuilder) WithDescription(description string) *BlueprintBuilder {
+	b.blueprint.Description = description
+	return b
+}
+
+func (b *BlueprintBuilder) WithTags(tags ...string) *BlueprintBuilder {
+	b.blueprint.Tags = append(b.blueprint.Tags, tags...)
+	return b
+}
+
+func (b *BlueprintBuilder) WithSelector(selector *Selector) *BlueprintBuilder {
+	b.blueprint.Selector = selector
+	return b
+}
+
 func (b *BlueprintBuilder) WithSpec(spec Specification) *BlueprintBuilder {
 	b.blueprint.Specs = append(b.blueprint.Specs, spec)
 	return b
 }
 
-func (b *BlueprintBuilder) WithDeferredSpec(fn func() Specification) *BlueprintBuilder {
-	return b.WithSpec(&DeferredSpec{SpecFunc: fn})
+// add a spec that is built from the project when it is first used; see
+// DeferredSpec
+func (b *BlueprintBuilder) WithDeferredSpec(fn func(project *Project) (Specification, error)) *BlueprintBuilder {
+	return b.WithSpec(Defer(fn))
 }
 
 func (b *BlueprintBuilder) WithSpecPresent(spec Specification) *BlueprintBuilder {
@@ -62,10 +248,23 @@ func (b *BlueprintBuilder) WithSpecReplace(spec Specification) *BlueprintBuilder
 }
 
 func (b *BlueprintBuilder) WithBlueprint(bp Blueprint) *BlueprintBuilder {
-	b.blueprint.Specs = append(b.blueprint.Specs, bp.Specs...)
+	b.blueprint.Specs = append(b.blueprint.Specs, bp.TaggedSpecs()...)
 	return b
 }
 
 func (b *BlueprintBuilder) Build() *Blueprint {
 	return b.blueprint
 }
+
+// return the specs of the blueprint with its tags added
+func (bp *Blueprint) TaggedSpecs() []Specification {
+	if len(bp.Tags) == 0 {
+		return bp.Specs
+	}
+
+	specs := make([]Specification, 0, len(bp.Specs))
+	for _, spec := range bp.Specs {
+		specs = append(specs, Tag(spec, bp.Tags...))
+	}
+	return specs
+}
@@ -9,11 +9,9 @@ func TestRegisterBlueprint(t *testing.T) {
 	}
 
 	RegisterBlueprint(bp)
+	defer Blueprints().Unregister("test-blueprint")
 
-	blueprintRegistry.lock.RLock()
-	defer blueprintRegistry.lock.RUnlock()
-
-	registered, ok := blueprintRegistry.blueprints["test-blueprint"]
+	registered, ok := GetBlueprint("test-blueprint")
 	if !ok {
 		t.Fatal("blueprint not found in registry")
 	}
@@ -22,12 +20,40 @@ func TestRegisterBlueprint(t *testing.T) {
 		t.Fatalf("expected blueprint name %s, got %s", bp.Name, registered.Name)
 	}
 
-	// clean up
-	blueprintRegistry.lock.RUnlock()
-	blueprintRegistry.lock.Lock()
-	delete(blueprintRegistry.blueprints, "test-blueprint")
-	blueprintRegistry.lock.Unlock()
-	blueprintRegistry.lock.RLock()
+	t.Run("info", func(t *testing.T) {
+		RegisterBlueprint(NewBlueprint("info-blueprint").
+			WithDescription("a test blueprint").
+			WithSpec(&TestSpec{}).
+			Build())
+		defer Blueprints().Unregister("info-blueprint")
+
+		info, ok := Blueprints().Info("info-blueprint")
+		if !ok {
+			t.Fatal("expected blueprint info")
+		}
+
+		expected := BlueprintInfo{Name: "info-blueprint", Description: "a test blueprint", Specs: 1, Package: "github.com/jheddings/go-spec"}
+		if info != expected {
+			t.Fatalf("unexpected info %+v", info)
+		}
+
+		infos := Blueprints().Infos()
+		if len(infos) != len(ListBlueprints()) {
+			t.Fatalf("expected an info for each blueprint, got %d", len(infos))
+		}
+	})
+
+	t.Run("unregister", func(t *testing.T) {
+		RegisterBlueprint(&Blueprint{Name: "unregister-blueprint"})
+
+		if !Blueprints().Unregister("unregister-blueprint") || Blueprints().Has("unregister-blueprint") {
+			t.Fatal("expected blueprint to be removed")
+		}
+
+		if Blueprints().Unregister("unregister-blueprint") {
+			t.Fatal("expected second unregister to report a missing blueprint")
+		}
+	})
 }
 
 func TestBlueprintBuilder(t *testing.T) {
@@ -84,8 +110,8 @@ func TestBlueprintBuilder(t *testing.T) {
 
 	t.Run("with deferred spec", func(t *testing.T) {
 		builder := NewBlueprint("test-bp")
-		builder = builder.WithDeferredSpec(func() Specification {
-			return &TestSpec{}
+		builder = builder.WithDeferredSpec(func(project *Project) (Specification, error) {
+			return &TestSpec{}, nil
 		})
 		bp := builder.Build()
 
@@ -0,0 +1,22 @@
+package spec
+
+// registration location reported for built-in specs
+const builtinLocation = "built-in"
+
+func init() {
+	registerBuiltins(defaultRegistry.Specs)
+}
+
+// register the built-in specs so they are available to declarative config;
+// the registry must not be shared yet, since no lock is taken.  this also
+// avoids logging during init, before logging is configured.
+func registerBuiltins(r *SpecRegistry) {
+	registerSpecType[ExecSpec](r, "exec", builtinLocation, WithSpecDescription("Run a command when a check command fails"))
+	registerSpecType[GitCloneSpec](r, "git-clone", builtinLocation, WithSpecDescription("Clone a git repository"))
+	registerSpecType[GitCheckoutSpec](r, "git-checkout", builtinLocation, WithSpecDescription("Check out a git branch, tag or commit"))
+	registerSpecType[GitRemoteSpec](r, "git-remote", builtinLocation, WithSpecDescription("Manage a git remote URL"))
+	registerSpecType[GitConfigSpec](r, "git-config", builtinLocation, WithSpecDescription("Manage a git config value"))
+	registerSpecType[PermissionSpec](r, "permission", builtinLocation, WithSpecDescription("Enforce file modes and ownership"))
+	registerSpecType[ArchiveSpec](r, "archive", builtinLocation, WithSpecDescription("Extract an archive into the project"))
+	registerSpecType[EnvFileSpec](r, "envfile", builtinLocation, WithSpecDescription("Manage a key in a dotenv file"))
+}
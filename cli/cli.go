@@ -0,0 +1,266 @@
+// Package cli provides the spec command line as a reusable application, so
+// downstream binaries can add their own spec registrations, flags and commands.
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jheddings/go-spec"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// process exit codes returned by App.Run
+const (
+	ExitClean = 0
+	ExitError = 1
+	ExitDrift = 2
+)
+
+// output formats for command results
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	errDrift  = errors.New("drift found")
+	errFailed = errors.New("one or more projects failed")
+)
+
+// App is a command line application for checking and applying projects.
+type App struct {
+	Name    string
+	Version string
+
+	// config files loaded when --config is not given; missing files are ignored
+	DefaultConfigs []string
+
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// registry for config files, projects and listings; defaults to the
+	// package default registry
+	Registry *spec.Registry
+
+	// settings from the common flags; valid once a command is running
+	Configs    []string
+	Workspaces []string
+	LogLevel   string
+	Format     string
+	Reports    []string
+	StateDir   string
+	Prune      bool
+
+	// roll back a project's applied specs if one of them fails
+	Transaction bool
+
+	// tag expression selecting the specs to run, e.g. "ci,!slow"
+	Tags string
+
+	// label selector for projects, e.g. "team=platform,lang in (go,rust)"
+	Selector string
+
+	// duplicate policy for config files (error, warn, override); the
+	// registry policy is unchanged if empty
+	Duplicates string
+
+	setup    []func(*App) error
+	root     *cobra.Command
+	tags     *spec.TagFilter
+	selector *spec.Selector
+}
+
+type AppBuilder struct {
+	app *App
+}
+
+func NewApp(name string) *AppBuilder {
+	return &AppBuilder{
+		app: &App{
+			Name:           name,
+			Version:        "dev",
+			DefaultConfigs: []string{"spec.yaml"},
+			Stdout:         os.Stdout,
+			Stderr:         os.Stderr,
+			Registry:       spec.Default(),
+		},
+	}
+}
+
+func (b *AppBuilder) WithVersion(version string) *AppBuilder {
+	b.app.Version = version
+	return b
+}
+
+func (b *AppBuilder) WithDefaultConfigs(paths ...string) *AppBuilder {
+	b.app.DefaultConfigs = paths
+	return b
+}
+
+func (b *AppBuilder) WithOutput(stdout, stderr io.Writer) *AppBuilder {
+	b.app.Stdout = stdout
+	b.app.Stderr = stderr
+	return b
+}
+
+func (b *AppBuilder) WithRegistry(registry *spec.Registry) *AppBuilder {
+	b.app.Registry = registry
+	return b
+}
+
+// add a function that runs after flags are parsed and logging is configured,
+// but before config files are loaded; use it to act on custom flags
+func (b *AppBuilder) WithSetup(fn func(*App) error) *AppBuilder {
+	b.app.setup = append(b.app.setup, fn)
+	return b
+}
+
+func (b *AppBuilder) Build() *App {
+	b.app.root = b.app.newRootCommand()
+	return b.app
+}
+
+// the root command; use it to add flags or subcommands
+func (a *App) Command() *cobra.Command {
+	return a.root
+}
+
+// run the application with os.Args and return the process exit code
+func (a *App) Execute() int {
+	return a.Run(os.Args[1:])
+}
+
+// run the application with the given arguments and return the process exit code
+func (a *App) Run(args []string) int {
+	a.root.SetArgs(args)
+	a.root.SetOut(a.Stdout)
+	a.root.SetErr(a.Stderr)
+
+	err := a.root.Execute()
+	switch {
+	case err == nil:
+		return ExitClean
+	case errors.Is(err, errDrift):
+		return ExitDrift
+	case errors.Is(err, errFailed):
+		return ExitError
+	}
+
+	fmt.Fprintf(a.Stderr, "error: %v\n", err)
+	return ExitError
+}
+
+func (a *App) newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:           a.Name,
+		Short:         "Check and apply project specifications",
+		Version:       a.Version,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return a.prepare(cmd)
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringSliceVarP(&a.Configs, "config", "c", nil, "project config files")
+	flags.StringSliceVarP(&a.Workspaces, "workspace", "w", nil, "workspace files, loaded after config files")
+	flags.StringVar(&a.LogLevel, "log-level", zerolog.WarnLevel.String(), "log level (trace, debug, info, warn, error)")
+	flags.StringVarP(&a.Format, "output", "o", FormatText, "output format (text, json)")
+	flags.StringSliceVar(&a.Reports, "report", nil, "write a report file (.json, .xml for JUnit, .md)")
+	flags.StringVar(&a.StateDir, "state-dir", "", "record applied specs in this directory")
+	flags.BoolVar(&a.Prune, "prune", false, "remove resources of applied specs that are no longer declared")
+	flags.BoolVar(&a.Transaction, "transaction", false, "roll back applied specs when a project fails")
+	flags.StringVarP(&a.Selector, "selector", "l", "", "only use projects matching the label selector (e.g. team=platform,lang in (go,rust))")
+	flags.StringVar(&a.Tags, "tags", "", "only run specs matching the tag expression (e.g. ci,!slow)")
+	flags.StringVar(&a.Duplicates, "duplicates", "", "handling of duplicate names in config files (error, warn, override)")
+
+	root.AddCommand(
+		a.newCheckCommand(),
+		a.newPlanCommand(),
+		a.newApplyCommand(),
+		a.newListCommand(),
+		a.newValidateCommand(),
+	)
+
+	return root
+}
+
+// configure logging, run setup functions and load config files
+func (a *App) prepare(cmd *cobra.Command) error {
+	level, err := zerolog.ParseLevel(a.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q", a.LogLevel)
+	}
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: a.Stderr}).Level(level)
+
+	if a.Format != FormatText && a.Format != FormatJSON {
+		return fmt.Errorf("invalid output format %q", a.Format)
+	}
+
+	if a.selector, err = spec.ParseSelector(a.Selector); err != nil {
+		return err
+	}
+
+	a.tags = nil
+	if a.Tags != "" {
+		filter, err := spec.ParseTagFilter(a.Tags)
+		if err != nil {
+			return err
+		}
+		a.tags = &filter
+	}
+
+	if a.Duplicates != "" {
+		policy, err := spec.ParseDuplicatePolicy(a.Duplicates)
+		if err != nil {
+			return err
+		}
+		a.Registry.SetDuplicatePolicy(policy)
+	}
+
+	for _, fn := range a.setup {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+
+	if cmd.Flags().Changed("config") {
+		err = a.loadConfigs(a.Configs, false)
+	} else {
+		err = a.loadConfigs(a.DefaultConfigs, true)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range a.Workspaces {
+		if err := a.Registry.LoadWorkspace(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load each config file into the registry, optionally ignoring missing files
+func (a *App) loadConfigs(paths []string, optional bool) error {
+	for _, path := range paths {
+		if _, err := os.Stat(path); optional && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err := a.Registry.LoadConfig(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
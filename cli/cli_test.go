@@ -0,0 +1,549 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jheddings/go-spec"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-test
+    path: .
+    specs:
+      - kind: envfile
+        config:
+          path: .env
+          key: GREETING
+          value: hello
+`)
+
+	t.Run("check reports drift", func(t *testing.T) {
+		stdout, code := runTest(t, "check", "-c", config, "cli-test")
+		if code != ExitDrift {
+			t.Fatalf("expected exit code %d, got %d", ExitDrift, code)
+		}
+
+		if !strings.Contains(stdout, "cli-test: 1 of 1 specs out of date") {
+			t.Fatalf("unexpected output: %s", stdout)
+		}
+	})
+
+	t.Run("plan lists specs", func(t *testing.T) {
+		stdout, code := runTest(t, "plan", "-c", config, "cli-test")
+		if code != ExitDrift {
+			t.Fatalf("expected exit code %d, got %d", ExitDrift, code)
+		}
+
+		if !strings.Contains(stdout, "~ envfile .env:GREETING") {
+			t.Fatalf("unexpected output: %s", stdout)
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		if _, code := runTest(t, "apply", "-c", config, "cli-test"); code != ExitClean {
+			t.Fatalf("expected exit code %d, got %d", ExitClean, code)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, ".env"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "GREETING=hello\n" {
+			t.Fatalf("unexpected env file %q", data)
+		}
+	})
+
+	t.Run("check after apply", func(t *testing.T) {
+		stdout, code := runTest(t, "check", "-c", config, "cli-test")
+		if code != ExitClean {
+			t.Fatalf("expected exit code %d, got %d", ExitClean, code)
+		}
+
+		if !strings.Contains(stdout, "cli-test: up to date") {
+			t.Fatalf("unexpected output: %s", stdout)
+		}
+	})
+}
+
+func TestRunList(t *testing.T) {
+	stdout, code := runTest(t, "list", "specs")
+	if code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d", ExitClean, code)
+	}
+
+	if !strings.Contains(stdout, "envfile\tManage a key in a dotenv file\n") {
+		t.Fatalf("expected built-in specs to be listed: %s", stdout)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		stdout, code := runTest(t, "list", "specs", "-o", "json")
+		if code != ExitClean {
+			t.Fatalf("expected exit code %d, got %d", ExitClean, code)
+		}
+
+		var entries []map[string]any
+		if err := json.Unmarshal([]byte(stdout), &entries); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+
+		for _, entry := range entries {
+			if entry["name"] == "envfile" {
+				if entry["config_type"] != "spec.EnvFileSpec" || entry["package"] != "github.com/jheddings/go-spec" {
+					t.Fatalf("unexpected entry %v", entry)
+				}
+				return
+			}
+		}
+
+		t.Fatalf("expected envfile in JSON listing: %s", stdout)
+	})
+}
+
+func TestRunErrors(t *testing.T) {
+	t.Run("invalid config", func(t *testing.T) {
+		config := writeTestConfig(t, t.TempDir(), "projects:\n  - name: bad\n    specs:\n      - kind: no-such-kind\n")
+
+		if _, code := runTest(t, "validate", "-c", config); code != ExitError {
+			t.Fatalf("expected exit code %d, got %d", ExitError, code)
+		}
+	})
+
+	t.Run("missing config", func(t *testing.T) {
+		if _, code := runTest(t, "check", "-c", filepath.Join(t.TempDir(), "missing.yaml")); code != ExitError {
+			t.Fatalf("expected exit code %d, got %d", ExitError, code)
+		}
+	})
+
+	t.Run("unknown project", func(t *testing.T) {
+		config := writeTestConfig(t, t.TempDir(), "projects:\n  - name: cli-known\n    path: .\n")
+
+		for _, command := range []string{"check", "plan", "apply"} {
+			if _, code := runTest(t, command, "-c", config, "cli-known", "cli-typo"); code != ExitError {
+				t.Fatalf("%s: expected exit code %d, got %d", command, ExitError, code)
+			}
+		}
+	})
+
+	t.Run("failing project", func(t *testing.T) {
+		config := writeTestConfig(t, t.TempDir(), `
+projects:
+  - name: cli-fail
+    path: .
+    specs:
+      - kind: exec
+        config:
+          check_command: ["false"]
+          apply_command: ["false"]
+`)
+
+		if _, code := runTest(t, "apply", "-c", config, "cli-fail"); code != ExitError {
+			t.Fatalf("expected exit code %d, got %d", ExitError, code)
+		}
+	})
+}
+
+func TestRunJSON(t *testing.T) {
+	config := writeTestConfig(t, t.TempDir(), `
+projects:
+  - name: cli-json
+    path: .
+    specs:
+      - kind: envfile
+        mode: ensure
+        config: { path: .env, key: A, value: "1" }
+`)
+
+	stdout, code := runTest(t, "plan", "-o", "json", "-c", config, "cli-json")
+	if code != ExitDrift {
+		t.Fatalf("expected exit code %d, got %d", ExitDrift, code)
+	}
+
+	var report spec.Report
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+
+	if len(report.Projects) == 0 || len(report.Projects[0].Specs) != 1 {
+		t.Fatalf("unexpected report %+v", report.Projects)
+	}
+
+	result := report.Projects[0].Specs[0]
+	if result.Spec != "ensure envfile .env:A" || result.Outcome != spec.OutcomeDrift {
+		t.Fatalf("unexpected spec report %+v", result)
+	}
+
+	if result.Diff != ".env: A added\n" {
+		t.Fatalf("unexpected diff %q", result.Diff)
+	}
+}
+
+func TestRunReportFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-report
+    path: .
+    specs:
+      - kind: envfile
+        config: { path: .env, key: A, value: "1" }
+`)
+
+	reports := []string{
+		filepath.Join(dir, "report.json"),
+		filepath.Join(dir, "report.xml"),
+		filepath.Join(dir, "report.md"),
+	}
+
+	if _, code := runTest(t, "check", "-c", config, "--report", strings.Join(reports, ","), "cli-report"); code != ExitDrift {
+		t.Fatalf("expected exit code %d, got %d", ExitDrift, code)
+	}
+
+	for _, path := range reports {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("expected report %s: %v", path, err)
+		}
+
+		if !strings.Contains(string(data), "cli-report") {
+			t.Fatalf("expected %s to include the project", path)
+		}
+	}
+
+	if _, code := runTest(t, "check", "-c", config, "--report", filepath.Join(dir, "report.txt")); code != ExitError {
+		t.Fatalf("expected exit code %d for unknown report format, got %d", ExitError, code)
+	}
+}
+
+func TestRunStateDir(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-state
+    path: .
+    specs:
+      - kind: envfile
+        config: { path: .env, key: A, value: "1" }
+`)
+
+	state := filepath.Join(dir, "state")
+	if _, code := runTest(t, "apply", "-c", config, "--state-dir", state, "cli-state"); code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d", ExitClean, code)
+	}
+
+	if _, err := os.Stat(filepath.Join(state, "cli-state.json")); err != nil {
+		t.Fatalf("expected state file: %v", err)
+	}
+
+	// the state directory applies to the run, not the registered project
+	if project, ok := spec.Default().Projects.Get("cli-state"); !ok || project.State != nil {
+		t.Fatalf("expected the registered project to be unchanged, got %+v", project)
+	}
+}
+
+func TestRunPrune(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-prune
+    path: .
+    specs:
+      - kind: envfile
+        config: { path: .env, key: A, value: "1" }
+`)
+
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("A=1\nB=2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a spec applied by an earlier run that has since been removed
+	state := filepath.Join(dir, "state")
+	if err := os.MkdirAll(state, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := `{"project": "cli-prune", "specs": {"orphan": {"kind": "envfile", "config": {"path": ".env", "key": "B", "value": "2"}}}}`
+	if err := os.WriteFile(filepath.Join(state, "cli-prune.json"), []byte(recorded), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, code := runTest(t, "check", "-c", config, "--state-dir", state, "cli-prune"); code != ExitClean {
+		t.Fatalf("expected exit code %d without --prune, got %d", ExitClean, code)
+	}
+
+	out, code := runTest(t, "plan", "-c", config, "--state-dir", state, "--prune", "cli-prune")
+	if code != ExitDrift {
+		t.Fatalf("expected exit code %d, got %d", ExitDrift, code)
+	}
+
+	if !strings.Contains(out, "prune envfile .env:B") {
+		t.Fatalf("expected prune in plan output:\n%s", out)
+	}
+
+	if _, code := runTest(t, "apply", "-c", config, "--state-dir", state, "--prune", "cli-prune"); code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d", ExitClean, code)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "A=1\n" {
+		t.Fatalf("expected orphaned key to be removed:\n%s", data)
+	}
+}
+
+func TestAppCustomization(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-custom
+    path: .
+    specs:
+      - kind: cli-test-spec
+`)
+
+	var stdout, stderr bytes.Buffer
+	var greeting string
+
+	app := NewApp("custom").
+		WithDefaultConfigs(config).
+		WithOutput(&stdout, &stderr).
+		WithSetup(func(app *App) error {
+			spec.RegisterSpec("cli-test-spec", func(config any) (spec.Specification, error) {
+				return &spec.ExecSpec{CheckCommand: []string{"true"}}, nil
+			})
+			return nil
+		}).
+		Build()
+
+	app.Command().PersistentFlags().StringVar(&greeting, "greeting", "", "custom flag")
+
+	if code := app.Run([]string{"check", "--greeting", "hi", "cli-custom"}); code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d: %s", ExitClean, code, stderr.String())
+	}
+
+	if greeting != "hi" {
+		t.Fatalf("expected custom flag to be parsed, got %q", greeting)
+	}
+
+	if !strings.Contains(stdout.String(), "cli-custom: up to date") {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+}
+
+func TestAppRegistry(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-registry
+    path: .
+`)
+
+	var stdout, stderr bytes.Buffer
+	registry := spec.NewRegistry()
+	app := NewApp("registry").WithRegistry(registry).WithOutput(&stdout, &stderr).Build()
+
+	if code := app.Run([]string{"list", "projects", "-c", config}); code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d: %s", ExitClean, code, stderr.String())
+	}
+
+	if !strings.HasPrefix(stdout.String(), "cli-registry\t") {
+		t.Fatalf("expected project from the registry, got %q", stdout.String())
+	}
+
+	if len(spec.FilterProjects([]string{"cli-registry"})) != 0 {
+		t.Fatal("expected the default registry to be unchanged")
+	}
+}
+
+func TestRunTags(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-tags
+    path: .
+    specs:
+      - kind: envfile
+        config: { path: .env, key: FAST, value: "1" }
+        tags: [ci]
+      - kind: envfile
+        config: { path: .env, key: SLOW, value: "1" }
+        tags: [ci, slow]
+`)
+
+	if _, code := runTest(t, "apply", "-c", config, "--tags", "ci,!slow", "cli-tags"); code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d", ExitClean, code)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "FAST=1\n" {
+		t.Fatalf("expected only the selected spec to be applied:\n%s", data)
+	}
+
+	if stdout, code := runTest(t, "check", "-c", config, "cli-tags"); code != ExitDrift || !strings.Contains(stdout, "1 of 2 specs out of date") {
+		t.Fatalf("expected the slow spec to be out of date, got %d: %s", code, stdout)
+	}
+
+	if _, code := runTest(t, "check", "-c", config, "--tags", "ci,,slow"); code != ExitError {
+		t.Fatalf("expected exit code %d for an invalid expression, got %d", ExitError, code)
+	}
+}
+
+func TestRunSelector(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestConfig(t, dir, `
+projects:
+  - name: cli-select-go
+    path: .
+    labels: { team: platform, lang: go }
+  - name: cli-select-rust
+    path: .
+    labels: { team: platform, lang: rust }
+  - name: cli-select-web
+    path: .
+    labels: { team: web }
+`)
+
+	var stdout, stderr bytes.Buffer
+	app := NewApp("selector").WithRegistry(spec.NewRegistry()).WithOutput(&stdout, &stderr).Build()
+
+	if code := app.Run([]string{"list", "projects", "-c", config, "-l", "team=platform,lang in (go,rust)", "-o", "json"}); code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d: %s", ExitClean, code, stderr.String())
+	}
+
+	var projects []struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &projects); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if len(projects) != 2 || projects[0].Name != "cli-select-go" || projects[1].Labels["lang"] != "rust" {
+		t.Fatalf("unexpected projects %+v", projects)
+	}
+
+	if stdout, code := runTest(t, "check", "-c", config, "--selector", "name=*-web"); code != ExitClean || strings.Contains(stdout, "cli-select-go") || !strings.Contains(stdout, "cli-select-web") {
+		t.Fatalf("expected only the selected project, got %d: %s", code, stdout)
+	}
+
+	if _, code := runTest(t, "check", "-c", config, "-l", "lang in (go"); code != ExitError {
+		t.Fatalf("expected exit code %d for an invalid selector, got %d", ExitError, code)
+	}
+}
+
+func TestRunDuplicates(t *testing.T) {
+	project := `
+projects:
+  - name: cli-duplicate
+    path: .
+`
+	first := writeTestConfig(t, t.TempDir(), project)
+	second := writeTestConfig(t, t.TempDir(), project)
+
+	var stdout, stderr bytes.Buffer
+	app := NewApp("duplicates").WithRegistry(spec.NewRegistry()).WithOutput(&stdout, &stderr).Build()
+
+	if code := app.Run([]string{"list", "projects", "--duplicates", "error", "-c", first, "-c", second}); code != ExitError {
+		t.Fatalf("expected exit code %d, got %d", ExitError, code)
+	}
+
+	if !strings.Contains(stderr.String(), "registered at "+second+" is already registered at "+first) {
+		t.Fatalf("expected both config files in the error: %s", stderr.String())
+	}
+
+	if code := app.Run([]string{"list", "projects", "--duplicates", "ignore"}); code != ExitError {
+		t.Fatalf("expected exit code %d for an unknown policy, got %d", ExitError, code)
+	}
+}
+
+func TestRunWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, `
+blueprints:
+  - name: cli-workspace-base
+    specs:
+      - kind: envfile
+        config: { path: .env, key: ORG, var: org }
+`)
+
+	for _, name := range []string{"cli-ws-a", "cli-ws-b"} {
+		if err := os.MkdirAll(filepath.Join(dir, "projects", name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workspace := filepath.Join(dir, "workspace.yaml")
+	content := "configs: [spec.yaml]\nvars: { org: acme }\nblueprints: [cli-workspace-base]\nprojects:\n  - path: projects/*\n"
+	if err := os.WriteFile(workspace, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	app := NewApp("workspace").WithRegistry(spec.NewRegistry()).WithOutput(&stdout, &stderr).Build()
+
+	if code := app.Run([]string{"apply", "-w", workspace}); code != ExitClean {
+		t.Fatalf("expected exit code %d, got %d: %s", ExitClean, code, stderr.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "projects", "cli-ws-b", ".env"))
+	if err != nil || string(data) != "ORG=acme\n" {
+		t.Fatalf("expected the workspace blueprint to be applied, got %q (%v)", data, err)
+	}
+
+	if _, code := runTest(t, "list", "projects", "--workspace", filepath.Join(dir, "missing.yaml")); code != ExitError {
+		t.Fatalf("expected exit code %d for a missing workspace, got %d", ExitError, code)
+	}
+}
+
+func TestRunFlags(t *testing.T) {
+	t.Run("invalid log level", func(t *testing.T) {
+		if _, code := runTest(t, "list", "specs", "--log-level", "loud"); code != ExitError {
+			t.Fatalf("expected exit code %d, got %d", ExitError, code)
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		if _, code := runTest(t, "list", "specs", "-o", "xml"); code != ExitError {
+			t.Fatalf("expected exit code %d, got %d", ExitError, code)
+		}
+	})
+}
+
+// Test helpers
+
+func writeTestConfig(t *testing.T, dir string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "spec.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func runTest(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	app := NewApp("spec").WithDefaultConfigs().WithOutput(&stdout, &stderr).Build()
+	code := app.Run(args)
+	t.Log(stderr.String())
+
+	return stdout.String(), code
+}
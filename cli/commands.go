@@ -0,0 +1,343 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jheddings/go-spec"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newCheckCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check [project...]",
+		Short: "Report which projects are out of date",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.plan(args, false)
+		},
+	}
+}
+
+func (a *App) newPlanCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "plan [project...]",
+		Short: "Show the specs that apply would change",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.plan(args, true)
+		},
+	}
+}
+
+// check the selected projects, optionally listing each out of date spec
+func (a *App) plan(names []string, detail bool) error {
+	projects, err := a.projects(names)
+	if err != nil {
+		return err
+	}
+
+	report := spec.NewReport()
+
+	// errors are recorded in the report
+	for _, project := range projects {
+		project.Plan(a.runOptions(report)...)
+	}
+
+	return a.writeReport(report, detail)
+}
+
+func (a *App) newApplyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "apply [project...]",
+		Short: "Bring projects up to date",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			projects, err := a.projects(args)
+			if err != nil {
+				return err
+			}
+
+			report := spec.NewReport()
+
+			// errors are recorded in the report
+			for _, project := range projects {
+				project.BuildAll(a.runOptions(report)...)
+			}
+
+			return a.writeReport(report, false)
+		},
+	}
+}
+
+// the projects with the given names (or all projects) that match the
+// selector; every name must be a registered project
+func (a *App) projects(names []string) ([]*spec.Project, error) {
+	for _, name := range names {
+		if !a.Registry.Projects.Has(name) {
+			return nil, fmt.Errorf("unknown project %q", name)
+		}
+	}
+
+	projects := []*spec.Project{}
+	for _, project := range a.Registry.Projects.Filter(names) {
+		if a.selector.Matches(project) {
+			projects = append(projects, project)
+		}
+	}
+
+	return projects, nil
+}
+
+func (a *App) runOptions(report *spec.Report) []spec.RunOption {
+	opts := []spec.RunOption{spec.WithReport(report)}
+
+	// the registered projects are shared, so the state directory only applies
+	// to this run
+	if a.StateDir != "" {
+		opts = append(opts, spec.WithStateStore(spec.NewFileStateStore(a.StateDir)))
+	}
+
+	if a.Prune {
+		opts = append(opts, spec.WithPrune())
+	}
+
+	if a.Transaction {
+		opts = append(opts, spec.WithTransaction())
+	}
+
+	if a.tags != nil {
+		opts = append(opts, spec.WithTags(*a.tags))
+	}
+
+	return opts
+}
+
+func (a *App) newListCommand() *cobra.Command {
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List registered projects, specs and blueprints",
+	}
+
+	list.AddCommand(
+		&cobra.Command{
+			Use:   "projects",
+			Short: "List registered projects",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				type entry struct {
+					Name   string            `json:"name"`
+					Path   string            `json:"path"`
+					Labels map[string]string `json:"labels,omitempty"`
+				}
+
+				projects, err := a.projects(nil)
+				if err != nil {
+					return err
+				}
+
+				entries := []entry{}
+				for _, project := range projects {
+					entries = append(entries, entry{Name: project.Name, Path: project.Path, Labels: project.Labels})
+				}
+
+				if a.Format == FormatJSON {
+					return writeJSON(a.Stdout, entries)
+				}
+
+				for _, e := range entries {
+					fmt.Fprintf(a.Stdout, "%s\t%s\n", e.Name, e.Path)
+				}
+
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "specs",
+			Short: "List registered spec kinds",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				type entry struct {
+					Name        string `json:"name"`
+					Description string `json:"description,omitempty"`
+					Namespace   string `json:"namespace,omitempty"`
+					ConfigType  string `json:"config_type,omitempty"`
+					Package     string `json:"package,omitempty"`
+				}
+
+				entries := []entry{}
+				for _, info := range a.Registry.Specs.Infos() {
+					e := entry{Name: info.Name, Description: info.Description, Namespace: info.Namespace, Package: info.Package}
+					if info.ConfigType != nil {
+						e.ConfigType = info.ConfigType.String()
+					}
+					entries = append(entries, e)
+				}
+
+				if a.Format == FormatJSON {
+					return writeJSON(a.Stdout, entries)
+				}
+
+				for _, e := range entries {
+					fmt.Fprintf(a.Stdout, "%s\t%s\n", e.Name, e.Description)
+				}
+
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "blueprints",
+			Short: "List registered blueprints",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				type entry struct {
+					Name        string `json:"name"`
+					Description string `json:"description,omitempty"`
+					Namespace   string `json:"namespace,omitempty"`
+					Specs       int    `json:"specs"`
+					Selector    string `json:"selector,omitempty"`
+					Package     string `json:"package,omitempty"`
+				}
+
+				entries := []entry{}
+				for _, info := range a.Registry.Blueprints.Infos() {
+					entries = append(entries, entry(info))
+				}
+
+				if a.Format == FormatJSON {
+					return writeJSON(a.Stdout, entries)
+				}
+
+				for _, e := range entries {
+					fmt.Fprintf(a.Stdout, "%s\t%s\n", e.Name, e.Description)
+				}
+
+				return nil
+			},
+		},
+	)
+
+	return list
+}
+
+func (a *App) newValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the project config files",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// configs are loaded (and every spec is built) before any command runs
+			count := len(a.Registry.Projects.Filter(nil))
+
+			if a.Format == FormatJSON {
+				return writeJSON(a.Stdout, map[string]int{"projects": count})
+			}
+
+			fmt.Fprintf(a.Stdout, "%d projects are valid\n", count)
+			return nil
+		},
+	}
+}
+
+// write the report in the selected format and to any report files, returning
+// the overall outcome
+func (a *App) writeReport(report *spec.Report, detail bool) error {
+	if err := a.writeReportFiles(report); err != nil {
+		return err
+	}
+
+	if a.Format == FormatJSON {
+		if err := report.WriteJSON(a.Stdout); err != nil {
+			return err
+		}
+	} else {
+		for _, project := range report.Projects {
+			a.writeProject(project, detail)
+		}
+	}
+
+	if report.Failed() {
+		return errFailed
+	}
+
+	if report.Count(spec.OutcomeDrift) > 0 {
+		return errDrift
+	}
+
+	return nil
+}
+
+func (a *App) writeProject(project *spec.ProjectReport, detail bool) {
+	if project.Error != "" {
+		fmt.Fprintf(a.Stderr, "%s: %s\n", project.Name, project.Error)
+		return
+	}
+
+	drift := project.Count(spec.OutcomeDrift)
+	applied := project.Count(spec.OutcomeApplied)
+
+	switch {
+	case drift > 0:
+		fmt.Fprintf(a.Stdout, "%s: %d of %d specs out of date\n", project.Name, drift, len(project.Specs))
+	case applied > 0:
+		fmt.Fprintf(a.Stdout, "%s: applied %d of %d specs\n", project.Name, applied, len(project.Specs))
+	default:
+		fmt.Fprintf(a.Stdout, "%s: up to date\n", project.Name)
+	}
+
+	if !detail {
+		return
+	}
+
+	for _, s := range project.Specs {
+		if s.Outcome != spec.OutcomeDrift {
+			continue
+		}
+
+		fmt.Fprintf(a.Stdout, "  ~ %s\n", s.Spec)
+		for line := range strings.Lines(s.Diff) {
+			fmt.Fprintf(a.Stdout, "      %s", line)
+		}
+	}
+}
+
+// write the report to each --report file, using the format implied by its extension
+func (a *App) writeReportFiles(report *spec.Report) error {
+	for _, path := range a.Reports {
+		var write func(io.Writer) error
+
+		switch filepath.Ext(path) {
+		case ".json":
+			write = report.WriteJSON
+		case ".xml":
+			write = report.WriteJUnit
+		case ".md":
+			write = report.WriteMarkdown
+		default:
+			return fmt.Errorf("unknown report format for %s", path)
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		if err := write(file); err != nil {
+			file.Close()
+			return err
+		}
+
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
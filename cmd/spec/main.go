@@ -0,0 +1,15 @@
+// Command spec checks and applies declarative project specifications.
+package main
+
+import (
+	"os"
+
+	"github.com/jheddings/go-spec/cli"
+)
+
+// set at build time
+var version = "dev"
+
+func main() {
+	os.Exit(cli.NewApp("spec").WithVersion(version).Build().Execute())
+}
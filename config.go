@@ -0,0 +1,338 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// spec modes available in declarative config
+const (
+	ModeDefault = ""
+	ModeEnsure  = "ensure"
+	ModeRemove  = "remove"
+	ModeReplace = "replace"
+)
+
+// Config is a declarative file of blueprints and projects.
+type Config struct {
+	Blueprints []BlueprintConfig `yaml:"blueprints"`
+	Projects   []ProjectConfig   `yaml:"projects"`
+
+	// file the config was loaded from, and the directory used to resolve
+	// relative project paths
+	path string
+	dir  string
+}
+
+// BlueprintConfig declares a blueprint from specs and other blueprints.
+type BlueprintConfig struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Blueprints  []string     `yaml:"blueprints"`
+	Specs       []SpecConfig `yaml:"specs"`
+
+	// tags added to each spec in the blueprint
+	Tags []string `yaml:"tags"`
+
+	// selector on project facts that applies the blueprint automatically to
+	// projects with detect enabled
+	Selector string `yaml:"selector"`
+}
+
+// ProjectConfig declares a project; blueprints are applied before specs.
+type ProjectConfig struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Path        string            `yaml:"path"`
+	URL         string            `yaml:"url"`
+	Vars        map[string]any    `yaml:"vars"`
+	Labels      map[string]string `yaml:"labels"`
+	Blueprints  []string          `yaml:"blueprints"`
+	Specs       []SpecConfig      `yaml:"specs"`
+
+	// default retry policy for the project's specs
+	Retry *RetryPolicy `yaml:"retry"`
+
+	// detect facts from the project files and apply blueprints whose
+	// selectors match them
+	Detect bool `yaml:"detect"`
+}
+
+// SpecConfig declares a registered spec by kind, with its config.
+type SpecConfig struct {
+	Kind   string       `yaml:"kind"`
+	Mode   string       `yaml:"mode"`
+	Config any          `yaml:"config"`
+	Retry  *RetryPolicy `yaml:"retry"`
+	Tags   []string     `yaml:"tags"`
+}
+
+// read a config file; relative project paths are resolved against its directory
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	config.path = path
+	config.dir = filepath.Dir(path)
+
+	return config, nil
+}
+
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// decode a generic config value (e.g. a map from a config file) into target,
+// which is typically a pointer to a spec struct
+func DecodeConfig(config any, target any) error {
+	if config == nil {
+		return nil
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	return decoder.Decode(target)
+}
+
+// build the blueprints and projects in the config and add them to the default
+// registry; see Registry.RegisterConfig
+func (c *Config) Register() error {
+	return defaultRegistry.registerConfig(c, callerPackage(1), callerLocation(1))
+}
+
+// build the projects in the config using the default registry
+func (c *Config) BuildProjects() ([]*Project, error) {
+	return defaultRegistry.BuildProjects(c)
+}
+
+// build the blueprint using the default registry
+func (c *BlueprintConfig) Build() (*Blueprint, error) {
+	return defaultRegistry.BuildBlueprint(c)
+}
+
+// build the project using the default registry; a relative path is resolved
+// against dir
+func (c *ProjectConfig) Build(dir string) (*Project, error) {
+	return defaultRegistry.BuildProject(c, dir)
+}
+
+// build the spec using the default registry
+func (c *SpecConfig) Build() (Specification, error) {
+	return defaultRegistry.BuildSpec(c)
+}
+
+// build a blueprint from specs and blueprints in the registry
+func (r *Registry) BuildBlueprint(c *BlueprintConfig) (*Blueprint, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("blueprint is missing a name")
+	}
+
+	for _, tag := range c.Tags {
+		if err := validateTag(tag); err != nil {
+			return nil, fmt.Errorf("blueprint %s: %w", c.Name, err)
+		}
+	}
+
+	builder := NewBlueprint(c.Name).WithDescription(c.Description).WithTags(c.Tags...)
+
+	if c.Selector != "" {
+		selector, err := ParseSelector(c.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("blueprint %s: %w", c.Name, err)
+		}
+		builder.WithSelector(selector)
+	}
+
+	for _, name := range c.Blueprints {
+		bp, ok := r.Blueprints.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("blueprint %s: blueprint %s not found", c.Name, name)
+		}
+		builder.WithBlueprint(*bp)
+	}
+
+	for idx, sc := range c.Specs {
+		spec, err := r.BuildSpec(&sc)
+		if err != nil {
+			return nil, fmt.Errorf("blueprint %s: spec %d: %w", c.Name, idx, err)
+		}
+		builder.WithSpec(spec)
+	}
+
+	return builder.Build(), nil
+}
+
+// build a project from specs and blueprints in the registry; a relative path
+// is resolved against dir
+func (r *Registry) BuildProject(c *ProjectConfig, dir string) (*Project, error) {
+	return r.buildProject(c, dir, DefaultDetectors())
+}
+
+// build a project, detecting facts with the detectors if the config enables
+// detection
+func (r *Registry) buildProject(c *ProjectConfig, dir string, detectors []Detector) (*Project, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("project is missing a name")
+	}
+
+	log.Trace().Str("project", c.Name).Msg("Loading project config")
+
+	path, err := expandPath(c.Path, dir)
+	if err != nil {
+		return nil, fmt.Errorf("project %s: %w", c.Name, err)
+	}
+
+	var facts map[string]string
+	if c.Detect {
+		if facts, err = DetectFacts(NewOSFS(path), detectors...); err != nil {
+			return nil, fmt.Errorf("project %s: %w", c.Name, err)
+		}
+	}
+
+	builder := NewProject(c.Name).
+		WithDescription(c.Description).
+		WithPath(path).
+		WithHomepage(c.URL).
+		WithRegistry(r)
+
+	for name, value := range c.Vars {
+		builder.WithVar(name, value)
+	}
+
+	for key, value := range c.Labels {
+		if err := validateLabelKey(key); err != nil {
+			return nil, fmt.Errorf("project %s: %w", c.Name, err)
+		}
+		builder.WithLabel(key, value)
+	}
+
+	if c.Retry != nil {
+		if err := c.Retry.validate(); err != nil {
+			return nil, fmt.Errorf("project %s: %w", c.Name, err)
+		}
+		builder.WithRetry(*c.Retry)
+	}
+
+	for key, value := range facts {
+		builder.WithFact(key, value)
+	}
+
+	for _, name := range c.Blueprints {
+		bp, ok := r.Blueprints.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("project %s: blueprint %s not found", c.Name, name)
+		}
+		builder.WithBlueprint(*bp)
+	}
+
+	// detected blueprints follow the declared ones
+	if c.Detect {
+		for _, bp := range r.Blueprints.Match(facts) {
+			if !slices.Contains(c.Blueprints, bp.Name) {
+				log.Debug().Str("project", c.Name).Str("blueprint", bp.Name).Msg("Applying detected blueprint")
+				builder.WithBlueprint(*bp)
+			}
+		}
+	}
+
+	for idx, sc := range c.Specs {
+		spec, err := r.BuildSpec(&sc)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: spec %d: %w", c.Name, idx, err)
+		}
+		builder.WithSpec(spec)
+	}
+
+	return builder.Build(), nil
+}
+
+// create the spec from the registry and wrap it for the configured mode
+func (r *Registry) BuildSpec(c *SpecConfig) (Specification, error) {
+	if c.Kind == "" {
+		return nil, fmt.Errorf("spec is missing a kind")
+	}
+
+	spec, err := r.Specs.Create(c.Kind, c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Mode {
+	case ModeDefault:
+	case ModeEnsure:
+		spec = &EnsureSpec{Spec: spec}
+	case ModeRemove:
+		spec = &RemoveSpec{Spec: spec}
+	case ModeReplace:
+		spec = &ReplaceSpec{Spec: spec}
+	default:
+		return nil, fmt.Errorf("unknown mode %q for spec %s", c.Mode, c.Kind)
+	}
+
+	if len(c.Tags) > 0 {
+		for _, tag := range c.Tags {
+			if err := validateTag(tag); err != nil {
+				return nil, fmt.Errorf("spec %s: %w", c.Kind, err)
+			}
+		}
+		spec = Tag(spec, c.Tags...)
+	}
+
+	// the retry policy wraps the mode so the project can find it
+	if c.Retry != nil {
+		if err := c.Retry.validate(); err != nil {
+			return nil, fmt.Errorf("spec %s: %w", c.Kind, err)
+		}
+		spec = Retry(spec, *c.Retry)
+	}
+
+	return spec, nil
+}
+
+// expand a leading ~ to the home directory and resolve relative paths against dir
+func expandPath(path, dir string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+
+	if path != "" && !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+
+	return path, nil
+}
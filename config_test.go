@@ -0,0 +1,238 @@
+package spec
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+blueprints:
+  - name: config-test-base
+    specs:
+      - kind: envfile
+        config:
+          path: .env
+          key: APP_NAME
+          var: name
+
+projects:
+  - name: config-test
+    description: test project
+    path: proj
+    url: https://example.com/proj
+    vars:
+      name: demo
+    blueprints: [config-test-base]
+    specs:
+      - kind: permission
+        config:
+          path: .env
+          mode: 0o600
+      - kind: envfile
+        mode: remove
+        config:
+          path: .env
+          key: OLD
+`
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+
+	if len(config.Blueprints) != 1 {
+		t.Fatalf("expected 1 blueprint, got %d", len(config.Blueprints))
+	}
+
+	if len(config.Projects) != 1 {
+		t.Fatalf("expected 1 project, got %d", len(config.Projects))
+	}
+
+	project := config.Projects[0]
+	if project.Name != "config-test" || project.Path != "proj" {
+		t.Fatalf("unexpected project %+v", project)
+	}
+
+	if len(project.Specs) != 2 || project.Specs[1].Mode != ModeRemove {
+		t.Fatalf("unexpected specs %+v", project.Specs)
+	}
+
+	t.Run("unknown field", func(t *testing.T) {
+		if _, err := ParseConfig([]byte("projects:\n  - nmae: typo\n")); err == nil {
+			t.Fatal("expected error for unknown field")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		config, err := ParseConfig(nil)
+		if err != nil {
+			t.Fatalf("ParseConfig failed: %v", err)
+		}
+
+		if len(config.Projects) != 0 {
+			t.Fatal("expected no projects")
+		}
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "proj"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "spec.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if err := config.Register(); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	defer Blueprints().Unregister("config-test-base")
+
+	projects := FilterProjects([]string{"config-test"})
+	if len(projects) != 1 {
+		t.Fatalf("expected 1 project, got %d", len(projects))
+	}
+
+	project := projects[0]
+	if project.Path != filepath.Join(dir, "proj") {
+		t.Fatalf("expected path relative to config, got %s", project.Path)
+	}
+
+	if len(project.Specs) != 3 {
+		t.Fatalf("expected 3 specs, got %d", len(project.Specs))
+	}
+
+	drift, err := project.Plan()
+	if err == nil && len(drift) == 0 {
+		t.Fatal("expected drift before apply")
+	}
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "proj", ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "APP_NAME=demo\n" {
+		t.Fatalf("unexpected env file %q", data)
+	}
+
+	assertTestMode(t, filepath.Join(dir, "proj", ".env"), 0o600)
+
+	drift, err = project.Plan()
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	if len(drift) != 0 {
+		t.Fatalf("expected no drift after apply, got %d", len(drift))
+	}
+}
+
+func TestSpecConfigBuild(t *testing.T) {
+	t.Run("decodes config", func(t *testing.T) {
+		sc := SpecConfig{Kind: "exec", Config: map[string]any{
+			"check_command": []any{"true"},
+			"timeout":       "5s",
+		}}
+
+		s, err := sc.Build()
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+
+		exec, ok := s.(*ExecSpec)
+		if !ok {
+			t.Fatalf("expected *ExecSpec, got %T", s)
+		}
+
+		if exec.Timeout != 5*time.Second || len(exec.CheckCommand) != 1 {
+			t.Fatalf("unexpected spec %+v", exec)
+		}
+	})
+
+	t.Run("typed config", func(t *testing.T) {
+		sc := SpecConfig{Kind: "permission", Mode: ModeEnsure, Config: PermissionSpec{Path: "x", Mode: Ptr(fs.FileMode(0o644))}}
+
+		s, err := sc.Build()
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+
+		ensure, ok := s.(*EnsureSpec)
+		if !ok {
+			t.Fatalf("expected *EnsureSpec, got %T", s)
+		}
+
+		if perm := ensure.Spec.(*PermissionSpec); perm.Path != "x" {
+			t.Fatalf("unexpected spec %+v", perm)
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		sc := SpecConfig{Kind: "envfile", Config: map[string]any{"file": ".env"}}
+
+		_, err := sc.Build()
+		if err == nil {
+			t.Fatal("expected error for unknown field")
+		}
+
+		if !strings.Contains(err.Error(), "invalid config for envfile") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("unknown kind", func(t *testing.T) {
+		sc := SpecConfig{Kind: "missing"}
+		if _, err := sc.Build(); err == nil {
+			t.Fatal("expected error for unknown kind")
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		sc := SpecConfig{Kind: "envfile", Mode: "delete"}
+		if _, err := sc.Build(); err == nil {
+			t.Fatal("expected error for unknown mode")
+		}
+	})
+}
+
+func TestProjectConfigMissingBlueprint(t *testing.T) {
+	pc := ProjectConfig{Name: "test", Blueprints: []string{"no-such-blueprint"}}
+
+	if _, err := pc.Build(""); err == nil {
+		t.Fatal("expected error for missing blueprint")
+	}
+}
+
+func TestListSpecs(t *testing.T) {
+	names := ListSpecs()
+
+	for _, want := range []string{"archive", "envfile", "exec", "git-clone", "permission"} {
+		found := false
+		for _, name := range names {
+			found = found || name == want
+		}
+
+		if !found {
+			t.Fatalf("expected built-in spec %s to be registered", want)
+		}
+	}
+}
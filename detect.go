@@ -0,0 +1,292 @@
+package spec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// facts reported by the built-in detectors
+const (
+	FactLanguage = "lang"
+	FactBuild    = "build"
+	FactCI       = "ci"
+	FactLicense  = "license"
+	FactModule   = "module"
+)
+
+// Detector inspects a project directory and reports facts about it, such as
+// its language or CI provider.  see DefaultDetectors.
+type Detector interface {
+	Detect(fsys fs.FS) (map[string]string, error)
+}
+
+// DetectorFunc adapts a function to the Detector interface.
+type DetectorFunc func(fsys fs.FS) (map[string]string, error)
+
+func (f DetectorFunc) Detect(fsys fs.FS) (map[string]string, error) {
+	return f(fsys)
+}
+
+// a detector that reports a fact for the first marker file that exists
+type markerDetector struct {
+	fact    string
+	markers []marker
+}
+
+type marker struct {
+	name  string
+	value string
+}
+
+// the built-in detectors, for language, build system, CI provider, license
+// and module path
+func DefaultDetectors() []Detector {
+	return []Detector{
+		&markerDetector{fact: FactLanguage, markers: []marker{
+			{"go.mod", "go"},
+			{"Cargo.toml", "rust"},
+			{"tsconfig.json", "typescript"},
+			{"package.json", "javascript"},
+			{"pyproject.toml", "python"},
+			{"setup.py", "python"},
+			{"requirements.txt", "python"},
+			{"pom.xml", "java"},
+			{"build.gradle", "java"},
+			{"build.gradle.kts", "kotlin"},
+			{"Gemfile", "ruby"},
+		}},
+		&markerDetector{fact: FactBuild, markers: []marker{
+			{"Makefile", "make"},
+			{"Taskfile.yml", "task"},
+			{"CMakeLists.txt", "cmake"},
+			{"Cargo.toml", "cargo"},
+			{"go.mod", "go"},
+			{"pnpm-lock.yaml", "pnpm"},
+			{"yarn.lock", "yarn"},
+			{"package.json", "npm"},
+			{"pom.xml", "maven"},
+			{"build.gradle", "gradle"},
+			{"build.gradle.kts", "gradle"},
+		}},
+		&markerDetector{fact: FactCI, markers: []marker{
+			{".github/workflows", "github-actions"},
+			{".gitlab-ci.yml", "gitlab"},
+			{".circleci/config.yml", "circleci"},
+			{"azure-pipelines.yml", "azure-pipelines"},
+			{"Jenkinsfile", "jenkins"},
+			{".travis.yml", "travis"},
+		}},
+		DetectorFunc(detectLicense),
+		DetectorFunc(detectModule),
+	}
+}
+
+// run the detectors against fsys; when detectors report the same fact, the
+// first one wins
+func DetectFacts(fsys fs.FS, detectors ...Detector) (map[string]string, error) {
+	facts := map[string]string{}
+
+	for _, detector := range detectors {
+		detected, err := detector.Detect(fsys)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range detected {
+			if _, ok := facts[key]; !ok {
+				facts[key] = value
+			}
+		}
+	}
+
+	return facts, nil
+}
+
+// detect facts about the project from its filesystem, using the default
+// detectors if none are given; detected facts replace existing ones
+func (p *Project) Detect(detectors ...Detector) error {
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors()
+	}
+
+	fsys := WritableFS(p.FS)
+	if fsys == nil {
+		fsys = NewOSFS(p.Path)
+	}
+
+	facts, err := DetectFacts(fsys, detectors...)
+	if err != nil {
+		return err
+	}
+
+	if p.Facts == nil {
+		p.Facts = map[string]string{}
+	}
+
+	maps.Copy(p.Facts, facts)
+	log.Debug().Str("project", p.Name).Any("facts", p.Facts).Msg("Detected project facts")
+
+	return nil
+}
+
+// add the specs of the registry's blueprints whose selectors match the
+// project facts, e.g. after Detect, and return the blueprints that were
+// added.  blueprints named in skip, such as those already applied, are left
+// out.
+func (p *Project) ApplyMatchingBlueprints(skip ...string) []*Blueprint {
+	applied := []*Blueprint{}
+	for _, bp := range p.registry().Blueprints.Match(p.Facts) {
+		if slices.Contains(skip, bp.Name) {
+			continue
+		}
+
+		log.Debug().Str("project", p.Name).Str("blueprint", bp.Name).Msg("Applying detected blueprint")
+		p.Specs = append(p.Specs, bp.TaggedSpecs()...)
+		applied = append(applied, bp)
+	}
+
+	return applied
+}
+
+func (d *markerDetector) Detect(fsys fs.FS) (map[string]string, error) {
+	for _, m := range d.markers {
+		ok, err := fileExists(fsys, m.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return map[string]string{d.fact: m.value}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// license file names, in order of preference
+var licenseFiles = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "COPYING", "COPYING.md"}
+
+// identify the license from the text of the license file; licenses that are
+// not recognized are reported as "other"
+func detectLicense(fsys fs.FS) (map[string]string, error) {
+	for _, name := range licenseFiles {
+		data, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return map[string]string{FactLicense: identifyLicense(string(data))}, nil
+	}
+
+	return nil, nil
+}
+
+func identifyLicense(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	switch {
+	case strings.Contains(text, "Permission is hereby granted, free of charge"):
+		return "MIT"
+	case strings.Contains(text, "Apache License") && strings.Contains(text, "Version 2.0"):
+		return "Apache-2.0"
+	case strings.Contains(text, "GNU AFFERO GENERAL PUBLIC LICENSE"):
+		return "AGPL-3.0"
+	case strings.Contains(text, "GNU LESSER GENERAL PUBLIC LICENSE"):
+		return "LGPL"
+	case strings.Contains(text, "GNU GENERAL PUBLIC LICENSE") && strings.Contains(text, "Version 3"):
+		return "GPL-3.0"
+	case strings.Contains(text, "GNU GENERAL PUBLIC LICENSE") && strings.Contains(text, "Version 2"):
+		return "GPL-2.0"
+	case strings.Contains(text, "Mozilla Public License Version 2.0"):
+		return "MPL-2.0"
+	case strings.Contains(text, "Redistribution and use in source and binary forms"):
+		if strings.Contains(text, "Neither the name") {
+			return "BSD-3-Clause"
+		}
+		return "BSD-2-Clause"
+	case strings.Contains(text, "This is free and unencumbered software released into the public domain"):
+		return "Unlicense"
+	}
+
+	return "other"
+}
+
+// read the module path from go.mod, or the package name from Cargo.toml or
+// package.json
+func detectModule(fsys fs.FS) (map[string]string, error) {
+	if module, err := configValue(fsys, "go.mod", "", "module"); module != "" || err != nil {
+		return map[string]string{FactModule: module}, err
+	}
+
+	if name, err := configValue(fsys, "Cargo.toml", "[package]", "name"); name != "" || err != nil {
+		return map[string]string{FactModule: name}, err
+	}
+
+	data, err := fs.ReadFile(fsys, "package.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var pkg struct {
+		Name string `json:"name"`
+	}
+
+	// a malformed package.json is not a detection error
+	if json.Unmarshal(data, &pkg) != nil || pkg.Name == "" {
+		return nil, nil
+	}
+
+	return map[string]string{FactModule: pkg.Name}, nil
+}
+
+// find a "key value" or "key = value" line in a file, optionally within a
+// [section]; quotes around the value are removed
+func configValue(fsys fs.FS, name, section, key string) (string, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			current = line
+			continue
+		}
+
+		if current != section {
+			continue
+		}
+
+		fields := strings.Fields(strings.Replace(line, "=", " ", 1))
+		if len(fields) == 2 && fields[0] == key {
+			return strings.Trim(fields[1], `"'`), nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+func fileExists(fsys fs.FS, name string) (bool, error) {
+	_, err := fs.Stat(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,323 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestDefaultDetectors(t *testing.T) {
+	fsys := newTestFS(t, map[string]string{
+		"go.mod":                   "module example.com/api\n\ngo 1.25\n",
+		"Makefile":                 "all:\n",
+		".github/workflows/ci.yml": "on: push\n",
+		"LICENSE":                  "MIT License\n\nPermission is hereby granted, free of charge, to any person\nobtaining a copy",
+	})
+
+	facts, err := DetectFacts(fsys, DefaultDetectors()...)
+	if err != nil {
+		t.Fatalf("DetectFacts failed: %v", err)
+	}
+
+	expected := map[string]string{
+		FactLanguage: "go",
+		FactBuild:    "make",
+		FactCI:       "github-actions",
+		FactLicense:  "MIT",
+		FactModule:   "example.com/api",
+	}
+
+	if !maps.Equal(facts, expected) {
+		t.Fatalf("expected facts %v, got %v", expected, facts)
+	}
+
+	t.Run("other ecosystems", func(t *testing.T) {
+		tests := []struct {
+			files map[string]string
+			facts map[string]string
+		}{
+			{
+				map[string]string{"Cargo.toml": "[workspace]\nname = \"ws\"\n\n[package]\nname = \"tool\"\n"},
+				map[string]string{FactLanguage: "rust", FactBuild: "cargo", FactModule: "tool"},
+			},
+			{
+				map[string]string{"package.json": `{"name": "@acme/web"}`, "tsconfig.json": "{}", "yarn.lock": ""},
+				map[string]string{FactLanguage: "typescript", FactBuild: "yarn", FactModule: "@acme/web"},
+			},
+			{
+				map[string]string{"package.json": "not json", ".gitlab-ci.yml": ""},
+				map[string]string{FactLanguage: "javascript", FactBuild: "npm", FactCI: "gitlab"},
+			},
+			{
+				map[string]string{"COPYING": "GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007"},
+				map[string]string{FactLicense: "GPL-3.0"},
+			},
+		}
+
+		for _, test := range tests {
+			facts, err := DetectFacts(newTestFS(t, test.files), DefaultDetectors()...)
+			if err != nil {
+				t.Fatalf("DetectFacts failed: %v", err)
+			}
+
+			if !maps.Equal(facts, test.facts) {
+				t.Fatalf("expected facts %v, got %v", test.facts, facts)
+			}
+		}
+	})
+
+	t.Run("first detector wins", func(t *testing.T) {
+		custom := DetectorFunc(func(fsys fs.FS) (map[string]string, error) {
+			return map[string]string{FactLanguage: "go-custom", "tier": "1"}, nil
+		})
+
+		facts, err := DetectFacts(fsys, append([]Detector{custom}, DefaultDetectors()...)...)
+		if err != nil {
+			t.Fatalf("DetectFacts failed: %v", err)
+		}
+
+		if facts[FactLanguage] != "go-custom" || facts["tier"] != "1" || facts[FactBuild] != "make" {
+			t.Fatalf("unexpected facts %v", facts)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		failing := DetectorFunc(func(fsys fs.FS) (map[string]string, error) {
+			return nil, errTestTransient
+		})
+
+		if _, err := DetectFacts(fsys, failing); !errors.Is(err, errTestTransient) {
+			t.Fatalf("expected detector error, got %v", err)
+		}
+	})
+}
+
+func TestIdentifyLicense(t *testing.T) {
+	tests := map[string]string{
+		"Apache License\n   Version 2.0, January 2004":                              "Apache-2.0",
+		"GNU GENERAL PUBLIC LICENSE\n Version 2, June 1991":                         "GPL-2.0",
+		"Mozilla Public License Version 2.0":                                        "MPL-2.0",
+		"Redistribution and use in source and binary forms, with or without":        "BSD-2-Clause",
+		"Redistribution and use in source and binary forms ... Neither the name of": "BSD-3-Clause",
+		"This is free and unencumbered software released into the public domain.":   "Unlicense",
+		"All rights reserved.": "other",
+	}
+
+	for text, want := range tests {
+		if got := identifyLicense(text); got != want {
+			t.Fatalf("expected %s, got %s for %q", want, got, text)
+		}
+	}
+}
+
+func TestProjectDetect(t *testing.T) {
+	fsys := newTestFS(t, map[string]string{"Cargo.toml": "[package]\nname = \"tool\"\n"})
+	project := NewProject("detect").WithFS(fsys).WithFact(FactLanguage, "unknown").WithFact("tier", "2").Build()
+
+	if err := project.Detect(); err != nil {
+		t.Fatalf("Detect failed: %v", err)
+	}
+
+	if project.Facts[FactLanguage] != "rust" || project.Facts["tier"] != "2" {
+		t.Fatalf("expected detected facts to replace existing ones, got %v", project.Facts)
+	}
+}
+
+func TestApplyMatchingBlueprints(t *testing.T) {
+	rust, err := ParseSelector("lang=rust")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %v", err)
+	}
+
+	registry := NewRegistry()
+	registry.Blueprints.Register(NewBlueprint("rust").WithSelector(rust).WithSpec(&TestSpec{}).Build())
+	registry.Blueprints.Register(NewBlueprint("rust-ci").WithSelector(rust).WithTags("ci").WithSpec(&TestSpec{}).Build())
+
+	fsys := newTestFS(t, map[string]string{"Cargo.toml": "[package]\nname = \"tool\"\n"})
+	project := NewProject("detect").WithFS(fsys).WithRegistry(registry).Build()
+
+	if applied := project.ApplyMatchingBlueprints(); len(applied) != 0 || len(project.Specs) != 0 {
+		t.Fatalf("expected no blueprints before detection, got %d", len(applied))
+	}
+
+	if err := project.Detect(); err != nil {
+		t.Fatalf("Detect failed: %v", err)
+	}
+
+	applied := project.ApplyMatchingBlueprints("rust-ci")
+	if len(applied) != 1 || applied[0].Name != "rust" || len(project.Specs) != 1 {
+		t.Fatalf("expected the rust blueprint to be applied, got %d blueprints and %d specs", len(applied), len(project.Specs))
+	}
+
+	t.Run("builder", func(t *testing.T) {
+		project := NewProject("builder").WithRegistry(registry).WithFact(FactLanguage, "rust").WithMatchingBlueprints().Build()
+
+		if len(project.Specs) != 2 || !slices.Equal(SpecTags(project.Specs[1]), []string{"ci"}) {
+			t.Fatalf("expected the specs of both blueprints with their tags, got %d specs", len(project.Specs))
+		}
+	})
+}
+
+func TestBlueprintSelectors(t *testing.T) {
+	golang, err := ParseSelector("lang=go")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %v", err)
+	}
+
+	ci, err := ParseSelector("ci in (github-actions,gitlab),lang!=rust")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %v", err)
+	}
+
+	registry := NewRegistry()
+	registry.Blueprints.Register(NewBlueprint("go").WithSelector(golang).WithSpec(&TestSpec{}).Build())
+	registry.Blueprints.Register(NewBlueprint("ci").WithSelector(ci).WithSpec(&TestSpec{}).Build())
+	registry.Blueprints.Register(NewBlueprint("manual").WithSpec(&TestSpec{}).Build())
+
+	tests := []struct {
+		facts map[string]string
+		want  []string
+	}{
+		{map[string]string{"lang": "go", "ci": "gitlab"}, []string{"ci", "go"}},
+		{map[string]string{"lang": "rust", "ci": "gitlab"}, []string{}},
+		{map[string]string{"ci": "github-actions"}, []string{"ci"}},
+		{nil, []string{}},
+	}
+
+	for _, test := range tests {
+		matched := registry.Blueprints.Match(test.facts)
+
+		names := []string{}
+		for _, bp := range matched {
+			names = append(names, bp.Name)
+		}
+
+		if len(names) != len(test.want) {
+			t.Fatalf("%v: expected %v, got %v", test.facts, test.want, names)
+		}
+
+		for idx := range names {
+			if names[idx] != test.want[idx] {
+				t.Fatalf("%v: expected %v, got %v", test.facts, test.want, names)
+			}
+		}
+	}
+
+	if info, _ := registry.Blueprints.Info("ci"); info.Selector != "ci in (github-actions,gitlab),lang!=rust" {
+		t.Fatalf("expected selector in blueprint info, got %q", info.Selector)
+	}
+
+	t.Run("name is a fact", func(t *testing.T) {
+		selector, err := ParseSelector("name=tool")
+		if err != nil {
+			t.Fatalf("ParseSelector failed: %v", err)
+		}
+
+		if selector.MatchesFacts(map[string]string{}) || !selector.MatchesFacts(map[string]string{"name": "tool"}) {
+			t.Fatal("expected name to be looked up in the facts")
+		}
+	})
+}
+
+func TestDetectConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTreeAt(t, dir, map[string]string{"api/go.mod": "module example.com/api\n"})
+
+	config, err := ParseConfig([]byte(`
+blueprints:
+  - name: detect-go
+    selector: lang=go
+    specs:
+      - kind: envfile
+        config: { path: .env, key: GO, value: "1" }
+  - name: detect-rust
+    selector: lang=rust
+    specs:
+      - kind: envfile
+        config: { path: .env, key: RUST, value: "1" }
+projects:
+  - name: detect-api
+    path: api
+    detect: true
+  - name: detect-manual
+    path: api
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	config.dir = dir
+
+	registry := NewRegistry()
+	if err := registry.RegisterConfig(config); err != nil {
+		t.Fatalf("RegisterConfig failed: %v", err)
+	}
+
+	projects := registry.Projects.Filter(nil)
+	if projects[0].Facts[FactModule] != "example.com/api" || len(projects[0].Specs) != 1 {
+		t.Fatalf("expected facts and the detected blueprint, got %v", projects[0].Facts)
+	}
+
+	if len(projects[1].Facts) != 0 || len(projects[1].Specs) != 0 {
+		t.Fatal("expected no detection unless enabled")
+	}
+
+	t.Run("discovery", func(t *testing.T) {
+		projects, err := NewDiscovery(dir).
+			WithRule(DiscoveryRule{Files: []string{"go.mod"}, Blueprints: []string{"detect-go"}}).
+			WithRegistry(registry).
+			Build().
+			Discover()
+		if err != nil {
+			t.Fatalf("Discover failed: %v", err)
+		}
+
+		// the rule and the selector name the same blueprint, which is applied once
+		if len(projects) != 1 || projects[0].Facts[FactLanguage] != "go" || len(projects[0].Specs) != 1 {
+			t.Fatalf("expected the detected blueprint once, got %+v", projects)
+		}
+
+		projects, err = NewDiscovery(dir).
+			WithRule(DiscoveryRule{Files: []string{"go.mod"}}).
+			WithDetectors().
+			WithRegistry(registry).
+			Build().
+			Discover()
+		if err != nil {
+			t.Fatalf("Discover failed: %v", err)
+		}
+
+		if len(projects[0].Facts) != 0 || len(projects[0].Specs) != 0 {
+			t.Fatal("expected no detection without detectors")
+		}
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		bc := BlueprintConfig{Name: "bad-selector", Selector: "lang in (go"}
+		if _, err := registry.BuildBlueprint(&bc); err == nil {
+			t.Fatal("expected error for an invalid selector")
+		}
+	})
+}
+
+// Test helpers
+
+// create a MemFS with the given files
+func newTestFS(t *testing.T, files map[string]string) *MemFS {
+	t.Helper()
+
+	fsys := NewMemFS()
+	for name, content := range files {
+		if err := fsys.MkdirAll(path.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fsys
+}
@@ -0,0 +1,341 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// default marker file for discovered projects
+const DefaultProjectFile = ".spec.yaml"
+
+// Discovery finds projects by scanning directories.  a directory is a project
+// if it contains the project file or matches one of the rules; directories
+// inside a project are not searched.  facts are detected for each project,
+// which applies blueprints with matching selectors.
+type Discovery struct {
+	Roots []string
+
+	// marker file for projects, which may contain a ProjectConfig; empty
+	// files are allowed
+	ProjectFile string
+
+	Rules []DiscoveryRule
+
+	// levels of directories below each root to search; zero means no limit
+	MaxDepth int
+
+	// directory names that are not searched; hidden directories are never
+	// searched
+	Skip []string
+
+	// detect facts for each project, to apply blueprints whose selectors
+	// match them; defaults to DefaultDetectors
+	Detectors []Detector
+
+	// registry for blueprints named by rules and project files, and for
+	// registering discovered projects; defaults to the default registry
+	Registry *Registry
+}
+
+// DiscoveryRule marks directories with matching files as projects, such as
+// Go modules with a go.mod file.
+type DiscoveryRule struct {
+	// files that must all exist in the directory; may be glob patterns
+	Files []string
+
+	// blueprints and labels for projects matching the rule
+	Blueprints []string
+	Labels     map[string]string
+}
+
+type DiscoveryBuilder struct {
+	discovery *Discovery
+}
+
+func NewDiscovery(roots ...string) *DiscoveryBuilder {
+	return &DiscoveryBuilder{
+		discovery: &Discovery{
+			Roots:       roots,
+			ProjectFile: DefaultProjectFile,
+			Skip:        []string{"node_modules", "vendor"},
+			Detectors:   DefaultDetectors(),
+		},
+	}
+}
+
+func (b *DiscoveryBuilder) WithProjectFile(name string) *DiscoveryBuilder {
+	b.discovery.ProjectFile = name
+	return b
+}
+
+func (b *DiscoveryBuilder) WithRule(rule DiscoveryRule) *DiscoveryBuilder {
+	b.discovery.Rules = append(b.discovery.Rules, rule)
+	return b
+}
+
+func (b *DiscoveryBuilder) WithMaxDepth(depth int) *DiscoveryBuilder {
+	b.discovery.MaxDepth = depth
+	return b
+}
+
+func (b *DiscoveryBuilder) WithSkip(names ...string) *DiscoveryBuilder {
+	b.discovery.Skip = append(b.discovery.Skip, names...)
+	return b
+}
+
+// replace the default detectors; with no detectors, facts are not detected
+func (b *DiscoveryBuilder) WithDetectors(detectors ...Detector) *DiscoveryBuilder {
+	b.discovery.Detectors = detectors
+	return b
+}
+
+func (b *DiscoveryBuilder) WithRegistry(registry *Registry) *DiscoveryBuilder {
+	b.discovery.Registry = registry
+	return b
+}
+
+func (b *DiscoveryBuilder) Build() *Discovery {
+	return b.discovery
+}
+
+// scan the roots and build a project for each project directory, in path
+// order.  project names default to the directory name and URLs to the origin
+// git remote.
+func (d *Discovery) Discover() ([]*Project, error) {
+	projects := []*Project{}
+
+	for _, root := range d.Roots {
+		root, err := expandPath(root, "")
+		if err != nil {
+			return nil, err
+		}
+
+		root, err = filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debug().Str("root", root).Msg("Discovering projects")
+
+		err = filepath.WalkDir(root, func(dir string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return walkError(root, dir, err)
+			}
+
+			if !entry.IsDir() {
+				return nil
+			}
+
+			if dir != root && d.skip(entry.Name()) {
+				return filepath.SkipDir
+			}
+
+			project, err := d.discover(dir)
+			if err != nil {
+				return err
+			}
+
+			if project != nil {
+				projects = append(projects, project)
+				return filepath.SkipDir
+			}
+
+			if d.MaxDepth > 0 && depth(root, dir) >= d.MaxDepth {
+				return filepath.SkipDir
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return projects, nil
+}
+
+// handle an error reading dir during discovery; directories below the root
+// that cannot be read are logged and skipped, so one unreadable directory does
+// not stop the scan
+func walkError(root, dir string, err error) error {
+	if dir == root {
+		return err
+	}
+
+	log.Warn().Err(err).Str("path", dir).Msg("Skipping unreadable directory")
+	return filepath.SkipDir
+}
+
+// discover projects and add them to the registry
+func (d *Discovery) Register() error {
+	projects, err := d.Discover()
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err := d.registry().Projects.register(project, project.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// build the project in dir, or return nil if dir is not a project
+func (d *Discovery) discover(dir string) (*Project, error) {
+	config, found, err := d.projectConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range d.Rules {
+		ok, err := rule.matches(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		found = true
+		for _, name := range rule.Blueprints {
+			if !slices.Contains(config.Blueprints, name) {
+				config.Blueprints = append(config.Blueprints, name)
+			}
+		}
+
+		// labels in the project file take precedence
+		for key, value := range rule.Labels {
+			if _, ok := config.Labels[key]; !ok {
+				config.Labels[key] = value
+			}
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	if config.Name == "" {
+		config.Name = filepath.Base(dir)
+	}
+
+	if config.Path == "" {
+		config.Path = dir
+	}
+
+	if config.URL == "" {
+		config.URL = gitRemoteURL(config.Name, dir)
+	}
+
+	if len(d.Detectors) > 0 {
+		config.Detect = true
+	}
+
+	log.Debug().Str("project", config.Name).Str("path", dir).Msg("Discovered project")
+
+	project, err := d.registry().buildProject(config, dir, d.Detectors)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+
+	return project, nil
+}
+
+// read the project file in dir, if there is one
+func (d *Discovery) projectConfig(dir string) (*ProjectConfig, bool, error) {
+	config := &ProjectConfig{Labels: map[string]string{}}
+	if d.ProjectFile == "" {
+		return config, false, nil
+	}
+
+	path := filepath.Join(dir, d.ProjectFile)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+
+	return config, true, nil
+}
+
+func (d *Discovery) skip(name string) bool {
+	return strings.HasPrefix(name, ".") || slices.Contains(d.Skip, name)
+}
+
+func (d *Discovery) registry() *Registry {
+	if d.Registry != nil {
+		return d.Registry
+	}
+	return defaultRegistry
+}
+
+func (r *DiscoveryRule) matches(dir string) (bool, error) {
+	if len(r.Files) == 0 {
+		return false, nil
+	}
+
+	for _, pattern := range r.Files {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return false, err
+		}
+
+		if len(matches) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// number of directories between root and dir
+func depth(root, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// the URL of the origin remote of the repository at dir, or empty if dir is
+// not the top of a repository with an origin.  the URL is kept as configured,
+// so it can be used to clone the project (see GitCloneSpec).
+func gitRemoteURL(name, dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return ""
+	}
+
+	url, err := runGit(&Project{Name: name}, dir, "remote", "get-url", "origin")
+	if err != nil {
+		log.Debug().Err(err).Str("project", name).Msg("No origin remote")
+		return ""
+	}
+
+	return url
+}
@@ -0,0 +1,155 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscovery(t *testing.T) {
+	root := t.TempDir()
+
+	writeTestTreeAt(t, root, map[string]string{
+		"api/.spec.yaml":          "name: api-server\nlabels: { team: platform }\n",
+		"api/go.mod":              "module example.com/api\n",
+		"group/svc/go.mod":        "module example.com/svc\n",
+		"group/svc/tool/go.mod":   "module example.com/svc/tool\n",
+		"group/web/package.json":  "{}\n",
+		"empty/.spec.yaml":        "",
+		"node_modules/dep/go.mod": "module example.com/dep\n",
+		".cache/mod/go.mod":       "module example.com/cache\n",
+		"deep/a/b/go.mod":         "module example.com/deep\n",
+	})
+
+	registry := NewRegistry()
+	registry.Blueprints.Register(NewBlueprint("go").WithSpec(&TestSpec{}).Build())
+
+	discovery := NewDiscovery(root).
+		WithRule(DiscoveryRule{Files: []string{"go.mod"}, Blueprints: []string{"go"}, Labels: map[string]string{"lang": "go", "team": "unknown"}}).
+		WithRegistry(registry).
+		Build()
+
+	projects, err := discovery.Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	names := []string{}
+	for _, project := range projects {
+		names = append(names, project.Name)
+	}
+
+	expected := []string{"api-server", "b", "empty", "svc"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected projects %v, got %v", expected, names)
+	}
+
+	for idx, name := range expected {
+		if names[idx] != name {
+			t.Fatalf("expected projects %v, got %v", expected, names)
+		}
+	}
+
+	api := projects[0]
+	if api.Path != filepath.Join(root, "api") || api.Registry != registry {
+		t.Fatalf("unexpected project %+v", api)
+	}
+
+	if api.Labels["team"] != "platform" || api.Labels["lang"] != "go" {
+		t.Fatalf("expected labels from the project file and rule, got %v", api.Labels)
+	}
+
+	if len(api.Specs) != 1 || len(projects[2].Specs) != 0 {
+		t.Fatal("expected blueprints only for projects matching the rule")
+	}
+
+	t.Run("max depth", func(t *testing.T) {
+		discovery := NewDiscovery(root).
+			WithRule(DiscoveryRule{Files: []string{"go.mod"}}).
+			WithProjectFile("").
+			WithMaxDepth(2).
+			WithRegistry(registry).
+			Build()
+
+		projects, err := discovery.Discover()
+		if err != nil {
+			t.Fatalf("Discover failed: %v", err)
+		}
+
+		// the project file is ignored, so api is found by its go.mod
+		if len(projects) != 2 || projects[0].Name != "api" || projects[1].Name != "svc" {
+			t.Fatalf("expected api and svc, got %d projects", len(projects))
+		}
+	})
+
+	t.Run("register", func(t *testing.T) {
+		registry.SetDuplicatePolicy(DuplicateError)
+
+		if err := discovery.Register(); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+
+		if len(registry.Projects.Filter([]string{"svc"})) != 1 {
+			t.Fatal("expected discovered projects in the registry")
+		}
+
+		if err := discovery.Register(); err == nil {
+			t.Fatal("expected duplicate projects to be rejected")
+		}
+	})
+
+	t.Run("unreadable directory", func(t *testing.T) {
+		if err := walkError(root, filepath.Join(root, "locked"), fs.ErrPermission); err != filepath.SkipDir {
+			t.Fatalf("expected unreadable directories to be skipped, got %v", err)
+		}
+
+		if err := walkError(root, root, fs.ErrNotExist); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected an unreadable root to fail, got %v", err)
+		}
+
+		if os.Geteuid() == 0 {
+			t.Skip("permissions are not enforced for root")
+		}
+
+		locked := filepath.Join(root, "locked")
+		if err := os.Mkdir(locked, 0o000); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Chmod(locked, 0o755) })
+
+		if projects, err := discovery.Discover(); err != nil || len(projects) != 4 {
+			t.Fatalf("expected the unreadable directory to be skipped, got %d projects (%v)", len(projects), err)
+		}
+	})
+
+	t.Run("invalid project file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestTreeAt(t, dir, map[string]string{"bad/.spec.yaml": "unknown: field\n"})
+
+		if _, err := NewDiscovery(dir).Build().Discover(); err == nil {
+			t.Fatal("expected error for an invalid project file")
+		}
+	})
+}
+
+func TestDiscoveryGitURL(t *testing.T) {
+	origin := newTestOrigin(t)
+	dir := cloneTestOrigin(t, origin)
+
+	runTestGit(t, dir, "remote", "set-url", "origin", "git@github.com:acme/clone.git")
+
+	projects, err := NewDiscovery(filepath.Dir(dir)).
+		WithRule(DiscoveryRule{Files: []string{".git"}}).
+		Build().
+		Discover()
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	// the remote is kept as is, so git specs can clone from it
+	if len(projects) != 1 || projects[0].URL != "git@github.com:acme/clone.git" {
+		t.Fatalf("expected URL from the origin remote, got %+v", projects)
+	}
+}
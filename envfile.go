@@ -0,0 +1,392 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// EnvFileSpec manages a single key in a dotenv-format file.  other keys,
+// comments and ordering in the file are preserved.
+type EnvFileSpec struct {
+	// env file to manage, relative to the project path
+	Path string `yaml:"path"`
+
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+
+	// optional project var used as the value, instead of Value
+	Var string `yaml:"var"`
+}
+
+// a line from an env file; only assignments have a key
+type envLine struct {
+	raw    string
+	eol    string // line ending as read; empty for new lines
+	key    string
+	value  string
+	export bool
+}
+
+func (s *EnvFileSpec) Check(project *Project) (bool, error) {
+	value, err := s.value(project)
+	if err != nil {
+		return false, err
+	}
+
+	lines, err := s.read(project)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, line := range lines {
+		if line.key == s.Key {
+			if line.value != value {
+				return false, nil
+			}
+			found = true
+		}
+	}
+
+	return found, nil
+}
+
+func (s *EnvFileSpec) Apply(project *Project) error {
+	value, err := s.value(project)
+	if err != nil {
+		return err
+	}
+
+	lines, err := s.read(project)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for idx, line := range lines {
+		if line.key == s.Key {
+			lines[idx] = line.with(value)
+			found = true
+		}
+	}
+
+	if !found {
+		lines = append(lines, envLine{key: s.Key}.with(value))
+	}
+
+	return s.write(project, lines)
+}
+
+func (s *EnvFileSpec) Exists(project *Project) (bool, error) {
+	lines, err := s.read(project)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range lines {
+		if line.key == s.Key {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *EnvFileSpec) Remove(project *Project) error {
+	lines, err := s.read(project)
+	if err != nil {
+		return err
+	}
+
+	kept := make([]envLine, 0, len(lines))
+	for _, line := range lines {
+		if line.key != s.Key {
+			kept = append(kept, line)
+		}
+	}
+
+	if len(kept) == len(lines) {
+		return nil
+	}
+
+	return s.write(project, kept)
+}
+
+// equal only when the key is defined exactly once with the desired value
+func (s *EnvFileSpec) Equals(project *Project) (bool, error) {
+	value, err := s.value(project)
+	if err != nil {
+		return false, err
+	}
+
+	lines, err := s.read(project)
+	if err != nil {
+		return false, err
+	}
+
+	count := 0
+	for _, line := range lines {
+		if line.key == s.Key {
+			if line.value != value {
+				return false, nil
+			}
+			count++
+		}
+	}
+
+	return count == 1, nil
+}
+
+// replace all definitions of the key with a single definition
+func (s *EnvFileSpec) Replace(project *Project) error {
+	value, err := s.value(project)
+	if err != nil {
+		return err
+	}
+
+	lines, err := s.read(project)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	replaced := make([]envLine, 0, len(lines))
+	for _, line := range lines {
+		if line.key != s.Key {
+			replaced = append(replaced, line)
+		} else if !found {
+			replaced = append(replaced, line.with(value))
+			found = true
+		}
+	}
+
+	if !found {
+		replaced = append(replaced, envLine{key: s.Key}.with(value))
+	}
+
+	return s.write(project, replaced)
+}
+
+// describe the change Apply would make; values are omitted since env files
+// often contain secrets
+func (s *EnvFileSpec) Diff(project *Project) (string, error) {
+	value, err := s.value(project)
+	if err != nil {
+		return "", err
+	}
+
+	lines, err := s.read(project)
+	if err != nil {
+		return "", err
+	}
+
+	found, changed := false, false
+	for _, line := range lines {
+		if line.key == s.Key {
+			found = true
+			changed = changed || line.value != value
+		}
+	}
+
+	switch {
+	case !found:
+		return fmt.Sprintf("%s: %s added\n", s.Path, s.Key), nil
+	case changed:
+		return fmt.Sprintf("%s: %s changed\n", s.Path, s.Key), nil
+	}
+
+	return "", nil
+}
+
+// record the env file so a failed transaction can restore it
+func (s *EnvFileSpec) Snapshot(project *Project) (Snapshot, error) {
+	fsys, name, err := project.ResolveFS(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return SnapshotFS(fsys, name)
+}
+
+// the key in the env file; see IdentifiableSpec
+func (s *EnvFileSpec) Resource() string {
+	return s.Path + ":" + s.Key
+}
+
+func (s *EnvFileSpec) String() string {
+	return "envfile " + s.Resource()
+}
+
+// the desired value, taken from the project vars if Var is set
+func (s *EnvFileSpec) value(project *Project) (string, error) {
+	if s.Key == "" {
+		return "", fmt.Errorf("env file spec requires a key")
+	}
+
+	if s.Var == "" {
+		return s.Value, nil
+	}
+
+	value, ok := project.Vars[s.Var]
+	if !ok {
+		return "", fmt.Errorf("project %s has no var %s", project.Name, s.Var)
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// read the env file; a missing file has no lines
+func (s *EnvFileSpec) read(project *Project) ([]envLine, error) {
+	fsys, name, err := project.ResolveFS(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fsys.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseEnv(string(data)), nil
+}
+
+func (s *EnvFileSpec) write(project *Project, lines []envLine) error {
+	fsys, name, err := project.ResolveFS(s.Path)
+	if err != nil {
+		return err
+	}
+
+	// new lines follow the ending of the first line, so CRLF files stay CRLF
+	eol := "\n"
+	if len(lines) > 0 && lines[0].eol != "" {
+		eol = lines[0].eol
+	}
+
+	var content strings.Builder
+	for _, line := range lines {
+		content.WriteString(line.raw)
+		if line.eol != "" {
+			content.WriteString(line.eol)
+		} else {
+			content.WriteString(eol)
+		}
+	}
+
+	// env files often contain secrets; new files are only readable by the owner
+	return fsys.WriteFile(name, []byte(content.String()), 0o600)
+}
+
+func parseEnv(content string) []envLine {
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" {
+		return nil
+	}
+
+	lines := []envLine{}
+	for _, raw := range strings.Split(content, "\n") {
+		line := parseEnvLine(strings.TrimSuffix(raw, "\r"))
+		line.eol = "\n"
+		if strings.HasSuffix(raw, "\r") {
+			line.eol = "\r\n"
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func parseEnvLine(raw string) envLine {
+	line := envLine{raw: raw}
+
+	text := strings.TrimSpace(raw)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return line
+	}
+
+	if rest, ok := strings.CutPrefix(text, "export "); ok {
+		line.export = true
+		text = strings.TrimSpace(rest)
+	}
+
+	key, value, ok := strings.Cut(text, "=")
+	if !ok {
+		return line
+	}
+
+	line.key = strings.TrimSpace(key)
+	line.value = parseEnvValue(strings.TrimSpace(value))
+
+	return line
+}
+
+func parseEnvValue(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	switch value[0] {
+	case '\'':
+		if end := strings.IndexByte(value[1:], '\''); end >= 0 {
+			return value[1 : end+1]
+		}
+
+	case '"':
+		var out strings.Builder
+		for idx := 1; idx < len(value); idx++ {
+			ch := value[idx]
+			if ch == '"' {
+				return out.String()
+			}
+			if ch == '\\' && idx+1 < len(value) {
+				idx++
+				switch value[idx] {
+				case 'n':
+					out.WriteByte('\n')
+				case 't':
+					out.WriteByte('\t')
+				default:
+					out.WriteByte(value[idx])
+				}
+				continue
+			}
+			out.WriteByte(ch)
+		}
+	}
+
+	// unquoted values end at an inline comment
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = value[:idx]
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// returns a copy of the line assigning the given value
+func (l envLine) with(value string) envLine {
+	prefix := ""
+	if l.export {
+		prefix = "export "
+	}
+
+	l.value = value
+	l.raw = prefix + l.key + "=" + formatEnvValue(value)
+	return l
+}
+
+func formatEnvValue(value string) string {
+	if !strings.ContainsAny(value, " \t\n\"'#\\$`") {
+		return value
+	}
+
+	// single quotes are literal, so prefer them when possible
+	if !strings.ContainsAny(value, "'\n") {
+		return "'" + value + "'"
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "$", `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,288 @@
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testEnvFile = `# service config
+export APP_NAME=demo
+DB_HOST=localhost # local only
+
+# credentials
+DB_PASS='s3cr3t'
+GREETING="hello\nworld"
+`
+
+func TestParseEnv(t *testing.T) {
+	lines := parseEnv(testEnvFile)
+
+	expected := map[string]string{
+		"APP_NAME": "demo",
+		"DB_HOST":  "localhost",
+		"DB_PASS":  "s3cr3t",
+		"GREETING": "hello\nworld",
+	}
+
+	found := 0
+	for _, line := range lines {
+		if line.key == "" {
+			continue
+		}
+
+		want, ok := expected[line.key]
+		if !ok {
+			t.Fatalf("unexpected key %s", line.key)
+		}
+
+		if line.value != want {
+			t.Fatalf("expected %s=%q, got %q", line.key, want, line.value)
+		}
+
+		found++
+	}
+
+	if found != len(expected) {
+		t.Fatalf("expected %d keys, got %d", len(expected), found)
+	}
+
+	if len(lines) != 7 {
+		t.Fatalf("expected 7 lines, got %d", len(lines))
+	}
+}
+
+func TestEnvFileSpec(t *testing.T) {
+	t.Run("ensure existing key", func(t *testing.T) {
+		dir := writeTestEnv(t, testEnvFile)
+		spec := &EnvFileSpec{Path: ".env", Key: "DB_HOST", Value: "db.internal"}
+		project := NewProject("test").WithPath(dir).WithSpec(spec).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false")
+		}
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		expected := `# service config
+export APP_NAME=demo
+DB_HOST=db.internal
+
+# credentials
+DB_PASS='s3cr3t'
+GREETING="hello\nworld"
+`
+		assertTestEnv(t, dir, expected)
+
+		if ok, _ := spec.Check(project); !ok {
+			t.Fatal("expected Check to return true after apply")
+		}
+	})
+
+	t.Run("ensure preserves export", func(t *testing.T) {
+		dir := writeTestEnv(t, "export APP_NAME=demo\n")
+		spec := &EnvFileSpec{Path: ".env", Key: "APP_NAME", Value: "my app"}
+		project := NewProject("test").WithPath(dir).Build()
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		assertTestEnv(t, dir, "export APP_NAME='my app'\n")
+	})
+
+	t.Run("ensure new key", func(t *testing.T) {
+		dir := writeTestEnv(t, "# comment\nA=1")
+		spec := &EnvFileSpec{Path: ".env", Key: "B", Value: "2"}
+		project := NewProject("test").WithPath(dir).Build()
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		assertTestEnv(t, dir, "# comment\nA=1\nB=2\n")
+	})
+
+	t.Run("ensure creates file", func(t *testing.T) {
+		dir := t.TempDir()
+		spec := &EnvFileSpec{Path: ".env", Key: "A", Value: "1"}
+		project := NewProject("test").WithPath(dir).Build()
+
+		if ok, _ := spec.Check(project); ok {
+			t.Fatal("expected Check to return false for missing file")
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		assertTestEnv(t, dir, "A=1\n")
+	})
+
+	t.Run("value from project var", func(t *testing.T) {
+		dir := writeTestEnv(t, "")
+		spec := &EnvFileSpec{Path: ".env", Key: "PORT", Var: "port"}
+		project := NewProject("test").WithPath(dir).WithVar("port", 8080).Build()
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		assertTestEnv(t, dir, "PORT=8080\n")
+	})
+
+	t.Run("missing project var", func(t *testing.T) {
+		dir := writeTestEnv(t, "")
+		spec := &EnvFileSpec{Path: ".env", Key: "PORT", Var: "port"}
+		project := NewProject("test").WithPath(dir).Build()
+
+		if _, err := spec.Check(project); err == nil {
+			t.Fatal("expected error for missing var")
+		}
+	})
+
+	t.Run("remove key", func(t *testing.T) {
+		dir := writeTestEnv(t, testEnvFile)
+		spec := &EnvFileSpec{Path: ".env", Key: "DB_PASS"}
+		project := NewProject("test").WithPath(dir).WithSpecRemove(spec).Build()
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		expected := `# service config
+export APP_NAME=demo
+DB_HOST=localhost # local only
+
+# credentials
+GREETING="hello\nworld"
+`
+		assertTestEnv(t, dir, expected)
+
+		if exists, _ := spec.Exists(project); exists {
+			t.Fatal("expected key to be removed")
+		}
+	})
+
+	t.Run("replace duplicate keys", func(t *testing.T) {
+		dir := writeTestEnv(t, "A=1\nB=2\nA=1\n")
+		spec := &EnvFileSpec{Path: ".env", Key: "A", Value: "1"}
+		project := NewProject("test").WithPath(dir).WithSpecReplace(spec).Build()
+
+		if ok, _ := spec.Check(project); !ok {
+			t.Fatal("expected Check to return true")
+		}
+
+		if equal, _ := spec.Equals(project); equal {
+			t.Fatal("expected Equals to return false with duplicates")
+		}
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		assertTestEnv(t, dir, "A=1\nB=2\n")
+	})
+
+	t.Run("crlf line endings", func(t *testing.T) {
+		dir := writeTestEnv(t, "# comment\r\nA=1\r\nB=2\r\n")
+		project := NewProject("test").
+			WithPath(dir).
+			WithSpec(&EnvFileSpec{Path: ".env", Key: "A", Value: "2"}).
+			WithSpec(&EnvFileSpec{Path: ".env", Key: "C", Value: "3"}).
+			WithSpecRemove(&EnvFileSpec{Path: ".env", Key: "B"}).
+			Build()
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		assertTestEnv(t, dir, "# comment\r\nA=2\r\nC=3\r\n")
+	})
+}
+
+func TestEnvFileSpecMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.WriteFile(".env", []byte("# comment\nA=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	project := NewProject("test").
+		WithFS(fsys).
+		WithSpec(&EnvFileSpec{Path: ".env", Key: "A", Value: "2"}).
+		WithSpec(&EnvFileSpec{Path: ".env", Key: "B", Value: "3"}).
+		Build()
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	data, err := fsys.ReadFile(".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "# comment\nA=2\nB=3\n" {
+		t.Fatalf("unexpected env file: %q", data)
+	}
+}
+
+func TestFormatEnvValue(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "", want: ""},
+		{value: "with space", want: "'with space'"},
+		{value: "$HOME", want: "'$HOME'"},
+		{value: "it's", want: `"it's"`},
+		{value: "a\nb", want: `"a\nb"`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.value, func(t *testing.T) {
+			got := formatEnvValue(tt.value)
+			if got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+
+			if parsed := parseEnvValue(got); parsed != tt.value {
+				t.Fatalf("round trip failed: %q != %q", parsed, tt.value)
+			}
+		})
+	}
+}
+
+// Test helpers
+
+func writeTestEnv(t *testing.T, content string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func assertTestEnv(t *testing.T, dir string, expected string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != expected {
+		t.Fatalf("unexpected env file:\n%s\nexpected:\n%s", data, expected)
+	}
+}
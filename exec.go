@@ -0,0 +1,241 @@
+package spec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// how long to wait for output once a command has been killed
+const execWaitDelay = time.Second
+
+// ExecSpec runs ApplyCommand whenever CheckCommand does not exit cleanly.
+type ExecSpec struct {
+	// command used to determine if the spec is satisfied; exit 0 means satisfied
+	CheckCommand []string `yaml:"check_command"`
+
+	// command used to bring the project into compliance
+	ApplyCommand []string `yaml:"apply_command"`
+
+	// working directory for both commands; defaults to the project path
+	Dir string `yaml:"dir"`
+
+	// additional environment; merged over the process env and project vars
+	Env map[string]string `yaml:"env"`
+
+	// maximum time allowed for each command; zero means no limit
+	Timeout time.Duration `yaml:"timeout"`
+
+	// if this path exists, the spec is considered satisfied
+	Creates string `yaml:"creates"`
+
+	// if this path does not exist, the spec is considered satisfied
+	Removes string `yaml:"removes"`
+
+	checkResult *ExecResult
+	applyResult *ExecResult
+}
+
+// ExecResult captures the outcome of a single command execution.
+type ExecResult struct {
+	Command  []string
+	Dir      string
+	ExitCode int
+	Output   string
+	Duration time.Duration
+}
+
+// ExecError is returned when a command fails to run or exits with an error.
+type ExecError struct {
+	Result *ExecResult
+	Err    error
+}
+
+func (e *ExecError) Error() string {
+	if e.Result == nil {
+		return fmt.Sprintf("command failed: %v", e.Err)
+	}
+
+	msg := fmt.Sprintf("command %q failed: %v", strings.Join(e.Result.Command, " "), e.Err)
+	if out := strings.TrimSpace(e.Result.Output); out != "" {
+		msg += ": " + out
+	}
+	return msg
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// result of the most recent check command, if any
+func (s *ExecSpec) CheckResult() *ExecResult {
+	return s.checkResult
+}
+
+// result of the most recent apply command, if any
+func (s *ExecSpec) ApplyResult() *ExecResult {
+	return s.applyResult
+}
+
+func (s *ExecSpec) Check(project *Project) (bool, error) {
+	if done, err := s.guarded(project); err != nil || done {
+		return done, err
+	}
+
+	if len(s.CheckCommand) == 0 {
+		return false, nil
+	}
+
+	result, err := s.run(project, s.CheckCommand)
+	s.checkResult = result
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, &ExecError{Result: result, Err: err}
+	}
+
+	return true, nil
+}
+
+func (s *ExecSpec) Apply(project *Project) error {
+	if len(s.ApplyCommand) == 0 {
+		return fmt.Errorf("exec spec has no apply command")
+	}
+
+	result, err := s.run(project, s.ApplyCommand)
+	s.applyResult = result
+
+	if err != nil {
+		return &ExecError{Result: result, Err: err}
+	}
+
+	return nil
+}
+
+// evaluate the creates / removes guards; returns true if either short-circuits
+func (s *ExecSpec) guarded(project *Project) (bool, error) {
+	if s.Creates != "" {
+		exists, err := pathExists(project, s.Creates)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	if s.Removes != "" {
+		exists, err := pathExists(project, s.Removes)
+		if err != nil || !exists {
+			return !exists, err
+		}
+	}
+
+	return false, nil
+}
+
+func (s *ExecSpec) String() string {
+	command := s.ApplyCommand
+	if len(command) == 0 {
+		command = s.CheckCommand
+	}
+	return describeFields("exec", strings.Join(command, " "))
+}
+
+func (s *ExecSpec) run(project *Project, command []string) (*ExecResult, error) {
+	// the result is recorded even if the command never runs
+	result := &ExecResult{Command: command, Dir: s.Dir, ExitCode: -1}
+
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return result, err
+	}
+	result.Dir = dir
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = s.environ(project)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	// children may hold the output open after the command is killed
+	killProcessGroup(cmd)
+	cmd.WaitDelay = execWaitDelay
+
+	log.Debug().Str("project", project.Name).Strs("command", command).Str("dir", dir).Msg("Running command")
+
+	start := time.Now()
+	err = cmd.Run()
+	result.Duration = time.Since(start)
+	result.Output = output.String()
+
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return result, fmt.Errorf("timed out after %s", s.Timeout)
+	}
+
+	return result, err
+}
+
+// build the command environment from the process, project vars and spec env
+func (s *ExecSpec) environ(project *Project) []string {
+	env := os.Environ()
+
+	keys := make([]string, 0, len(project.Vars))
+	for key := range project.Vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		env = append(env, fmt.Sprintf("%s=%v", key, project.Vars[key]))
+	}
+
+	keys = keys[:0]
+	for key := range s.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		env = append(env, key+"="+s.Env[key])
+	}
+
+	return env
+}
+
+// helper to determine if a project-relative path exists
+func pathExists(project *Project, path string) (bool, error) {
+	fsys, name, err := project.ResolveFS(path)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = fsys.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package spec
+
+import "os/exec"
+
+// process groups are not supported; only the command itself is killed
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,274 @@
+package spec
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecSpecCheck(t *testing.T) {
+	t.Run("check passes", func(t *testing.T) {
+		spec := &ExecSpec{CheckCommand: []string{"true"}}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected Check to return true")
+		}
+	})
+
+	t.Run("check fails", func(t *testing.T) {
+		spec := &ExecSpec{CheckCommand: []string{"false"}}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false")
+		}
+
+		if spec.CheckResult().ExitCode != 1 {
+			t.Fatalf("expected exit code 1, got %d", spec.CheckResult().ExitCode)
+		}
+	})
+
+	t.Run("no check command", func(t *testing.T) {
+		spec := &ExecSpec{ApplyCommand: []string{"true"}}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false")
+		}
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		spec := &ExecSpec{CheckCommand: []string{"no-such-command-for-go-spec"}}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		_, err := spec.Check(project)
+		if err == nil {
+			t.Fatal("expected error for missing command")
+		}
+
+		var execErr *ExecError
+		if !errors.As(err, &execErr) {
+			t.Fatalf("expected ExecError, got %T", err)
+		}
+	})
+
+	t.Run("creates guard", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "done"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		spec := &ExecSpec{CheckCommand: []string{"false"}, Creates: "done"}
+		project := NewProject("test").WithPath(dir).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected creates guard to satisfy Check")
+		}
+
+		if spec.CheckResult() != nil {
+			t.Fatal("check command should not have run")
+		}
+	})
+
+	t.Run("removes guard", func(t *testing.T) {
+		spec := &ExecSpec{CheckCommand: []string{"false"}, Removes: "missing"}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected removes guard to satisfy Check")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		// the shell forks, so the child holds the output open after the shell
+		// is killed
+		spec := &ExecSpec{
+			CheckCommand: []string{"sh", "-c", "sleep 5; true"},
+			Timeout:      50 * time.Millisecond,
+		}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		start := time.Now()
+		_, err := spec.Check(project)
+		if err == nil {
+			t.Fatal("expected timeout error")
+		}
+
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("expected the command to stop at the timeout, took %s", elapsed)
+		}
+
+		if !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("expected timeout error, got %q", err.Error())
+		}
+	})
+}
+
+func TestExecSpecApply(t *testing.T) {
+	t.Run("apply in project dir", func(t *testing.T) {
+		dir := t.TempDir()
+		spec := &ExecSpec{ApplyCommand: []string{"sh", "-c", "pwd > out.txt"}}
+		project := NewProject("test").WithPath(dir).Build()
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, _ := filepath.EvalSymlinks(dir)
+		got, _ := filepath.EvalSymlinks(strings.TrimSpace(string(data)))
+		if got != want {
+			t.Fatalf("expected working dir %s, got %s", want, got)
+		}
+	})
+
+	t.Run("apply with env", func(t *testing.T) {
+		spec := &ExecSpec{
+			ApplyCommand: []string{"sh", "-c", "echo $GREETING $TARGET"},
+			Env:          map[string]string{"TARGET": "world"},
+		}
+		project := NewProject("test").
+			WithPath(t.TempDir()).
+			WithVar("GREETING", "hello").
+			Build()
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		output := strings.TrimSpace(spec.ApplyResult().Output)
+		if output != "hello world" {
+			t.Fatalf("expected output %q, got %q", "hello world", output)
+		}
+	})
+
+	t.Run("apply failure captures output", func(t *testing.T) {
+		spec := &ExecSpec{ApplyCommand: []string{"sh", "-c", "echo oops; exit 3"}}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		err := spec.Apply(project)
+		if err == nil {
+			t.Fatal("expected error from Apply")
+		}
+
+		var execErr *ExecError
+		if !errors.As(err, &execErr) {
+			t.Fatalf("expected ExecError, got %T", err)
+		}
+
+		if execErr.Result.ExitCode != 3 {
+			t.Fatalf("expected exit code 3, got %d", execErr.Result.ExitCode)
+		}
+
+		if !strings.Contains(err.Error(), "oops") {
+			t.Fatalf("expected output in error, got %q", err.Error())
+		}
+	})
+
+	t.Run("escaping dir", func(t *testing.T) {
+		spec := &ExecSpec{CheckCommand: []string{"true"}, ApplyCommand: []string{"true"}, Dir: "../"}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		if _, err := spec.Check(project); !errors.Is(err, ErrOutsideRoot) || err.Error() == "" {
+			t.Fatalf("expected Check to reject the dir, got %v", err)
+		}
+
+		err := spec.Apply(project)
+
+		var execErr *ExecError
+		if !errors.As(err, &execErr) || execErr.Result.Dir != "../" || !strings.Contains(err.Error(), `"true"`) {
+			t.Fatalf("expected ExecError with the unresolved dir, got %v", err)
+		}
+
+		if msg := (&ExecError{Err: ErrOutsideRoot}).Error(); !strings.Contains(msg, ErrOutsideRoot.Error()) {
+			t.Fatalf("unexpected message %q without a result", msg)
+		}
+	})
+
+	t.Run("in-memory project", func(t *testing.T) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		spec := &ExecSpec{CheckCommand: []string{"false"}, ApplyCommand: []string{"touch", "go-spec-marker"}}
+		project := NewProject("test").WithFS(NewMemFS()).Build()
+
+		if _, err := spec.Check(project); !errors.Is(err, ErrNotHostFS) {
+			t.Fatalf("expected Check to require the host filesystem, got %v", err)
+		}
+
+		if err := spec.Apply(project); !errors.Is(err, ErrNotHostFS) {
+			t.Fatalf("expected Apply to require the host filesystem, got %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(cwd, "go-spec-marker")); err == nil {
+			os.Remove(filepath.Join(cwd, "go-spec-marker"))
+			t.Fatal("expected the command not to run on the host")
+		}
+	})
+
+	t.Run("no apply command", func(t *testing.T) {
+		spec := &ExecSpec{}
+		project := NewProject("test").Build()
+
+		if err := spec.Apply(project); err == nil {
+			t.Fatal("expected error from Apply")
+		}
+	})
+
+	t.Run("build all runs apply when check fails", func(t *testing.T) {
+		dir := t.TempDir()
+		spec := &ExecSpec{
+			CheckCommand: []string{"test", "-f", "marker"},
+			ApplyCommand: []string{"touch", "marker"},
+		}
+		project := NewProject("test").WithPath(dir).WithSpec(spec).Build()
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "marker")); err != nil {
+			t.Fatal("expected marker to be created")
+		}
+
+		ok, err := spec.Check(project)
+		if err != nil || !ok {
+			t.Fatal("expected Check to pass after apply")
+		}
+	})
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package spec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// run the command in its own process group, and kill the whole group when the
+// command is canceled so children don't keep it running
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
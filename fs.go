@@ -0,0 +1,279 @@
+package spec
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WritableFS extends io/fs with the write operations needed by specs.  names
+// follow the io/fs conventions: slash-separated and relative to the root.
+type WritableFS interface {
+	fs.StatFS
+	fs.ReadFileFS
+	fs.ReadDirFS
+	fs.ReadLinkFS
+
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Symlink(target, name string) error
+	Chmod(name string, mode fs.FileMode) error
+	Lchown(name string, uid, gid int) error
+}
+
+// OSFS is a WritableFS backed by a directory of the host filesystem.  names
+// are validated, but symlinks are followed wherever they point.
+type OSFS struct {
+	dir string
+}
+
+func NewOSFS(dir string) *OSFS {
+	return &OSFS{dir: dir}
+}
+
+// helper to convert an io/fs name to a host path
+func (o *OSFS) path(op, name string) (string, error) {
+	if err := validName(op, name); err != nil {
+		return "", err
+	}
+	return filepath.Join(o.dir, filepath.FromSlash(name)), nil
+}
+
+func (o *OSFS) Open(name string) (fs.File, error) {
+	path, err := o.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (o *OSFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := o.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+func (o *OSFS) Lstat(name string) (fs.FileInfo, error) {
+	path, err := o.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(path)
+}
+
+func (o *OSFS) ReadLink(name string) (string, error) {
+	path, err := o.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
+
+func (o *OSFS) ReadFile(name string) ([]byte, error) {
+	path, err := o.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (o *OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := o.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(path)
+}
+
+func (o *OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	path, err := o.path("writefile", name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+func (o *OSFS) Mkdir(name string, perm fs.FileMode) error {
+	path, err := o.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(path, perm)
+}
+
+func (o *OSFS) MkdirAll(name string, perm fs.FileMode) error {
+	path, err := o.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, perm)
+}
+
+func (o *OSFS) Remove(name string) error {
+	path, err := o.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (o *OSFS) RemoveAll(name string) error {
+	path, err := o.path("removeall", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+func (o *OSFS) Symlink(target, name string) error {
+	path, err := o.path("symlink", name)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(target), path)
+}
+
+func (o *OSFS) Chmod(name string, mode fs.FileMode) error {
+	path, err := o.path("chmod", name)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+func (o *OSFS) Lchown(name string, uid, gid int) error {
+	path, err := o.path("lchown", name)
+	if err != nil {
+		return err
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+// RootFS is a WritableFS jailed to a directory using os.Root.  no operation,
+// including following symlinks, may reach outside the root.
+type RootFS struct {
+	root *os.Root
+}
+
+func NewRootFS(dir string) (*RootFS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &RootFS{root: root}, nil
+}
+
+func (r *RootFS) Close() error {
+	return r.root.Close()
+}
+
+func (r *RootFS) Open(name string) (fs.File, error) {
+	if err := validName("open", name); err != nil {
+		return nil, err
+	}
+	return r.root.Open(name)
+}
+
+func (r *RootFS) Stat(name string) (fs.FileInfo, error) {
+	if err := validName("stat", name); err != nil {
+		return nil, err
+	}
+	return r.root.Stat(name)
+}
+
+func (r *RootFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := validName("lstat", name); err != nil {
+		return nil, err
+	}
+	return r.root.Lstat(name)
+}
+
+func (r *RootFS) ReadLink(name string) (string, error) {
+	if err := validName("readlink", name); err != nil {
+		return "", err
+	}
+	return r.root.Readlink(name)
+}
+
+func (r *RootFS) ReadFile(name string) ([]byte, error) {
+	if err := validName("readfile", name); err != nil {
+		return nil, err
+	}
+	return r.root.ReadFile(name)
+}
+
+func (r *RootFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := validName("readdir", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(r.root.FS(), name)
+}
+
+func (r *RootFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := validName("writefile", name); err != nil {
+		return err
+	}
+	return r.root.WriteFile(name, data, perm)
+}
+
+func (r *RootFS) Mkdir(name string, perm fs.FileMode) error {
+	if err := validName("mkdir", name); err != nil {
+		return err
+	}
+	return r.root.Mkdir(name, perm)
+}
+
+func (r *RootFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := validName("mkdir", name); err != nil {
+		return err
+	}
+	return r.root.MkdirAll(name, perm)
+}
+
+func (r *RootFS) Remove(name string) error {
+	if err := validName("remove", name); err != nil {
+		return err
+	}
+	return r.root.Remove(name)
+}
+
+func (r *RootFS) RemoveAll(name string) error {
+	if err := validName("removeall", name); err != nil {
+		return err
+	}
+	return r.root.RemoveAll(name)
+}
+
+func (r *RootFS) Symlink(target, name string) error {
+	if err := validName("symlink", name); err != nil {
+		return err
+	}
+	return r.root.Symlink(filepath.FromSlash(target), name)
+}
+
+func (r *RootFS) Chmod(name string, mode fs.FileMode) error {
+	if err := validName("chmod", name); err != nil {
+		return err
+	}
+	return r.root.Chmod(name, mode)
+}
+
+func (r *RootFS) Lchown(name string, uid, gid int) error {
+	if err := validName("lchown", name); err != nil {
+		return err
+	}
+	return r.root.Lchown(name, uid, gid)
+}
+
+// helper to verify a name follows the io/fs conventions
+func validName(op, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWritableFS(t *testing.T) {
+	impls := []struct {
+		name string
+		new  func(t *testing.T) WritableFS
+	}{
+		{
+			name: "os",
+			new: func(t *testing.T) WritableFS {
+				return NewOSFS(t.TempDir())
+			},
+		},
+		{
+			name: "root",
+			new: func(t *testing.T) WritableFS {
+				root, err := NewRootFS(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { root.Close() })
+				return root
+			},
+		},
+		{
+			name: "mem",
+			new: func(t *testing.T) WritableFS {
+				return NewMemFS()
+			},
+		},
+	}
+
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			testWritableFS(t, impl.new(t))
+		})
+	}
+}
+
+func testWritableFS(t *testing.T, fsys WritableFS) {
+	t.Run("write and read", func(t *testing.T) {
+		if err := fsys.MkdirAll("a/b", 0o755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+
+		if err := fsys.WriteFile("a/b/file.txt", []byte("hello"), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		data, err := fsys.ReadFile("a/b/file.txt")
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		if string(data) != "hello" {
+			t.Fatalf("unexpected content %q", data)
+		}
+
+		if err := fstest.TestFS(fsys, "a/b/file.txt"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("overwrite keeps mode", func(t *testing.T) {
+		if err := fsys.WriteFile("keep.txt", []byte("one"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.WriteFile("keep.txt", []byte("two"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := fsys.Stat("keep.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected mode 0600, got %s", info.Mode().Perm())
+		}
+	})
+
+	t.Run("write to missing dir", func(t *testing.T) {
+		err := fsys.WriteFile("missing/file.txt", nil, 0o644)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("mkdir existing", func(t *testing.T) {
+		if err := fsys.Mkdir("dup", 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Mkdir("dup", 0o755); !errors.Is(err, fs.ErrExist) {
+			t.Fatalf("expected ErrExist, got %v", err)
+		}
+	})
+
+	t.Run("chmod", func(t *testing.T) {
+		if err := fsys.WriteFile("mode.txt", nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Chmod("mode.txt", 0o751); err != nil {
+			t.Fatalf("Chmod failed: %v", err)
+		}
+
+		info, err := fsys.Stat("mode.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0o751 {
+			t.Fatalf("expected mode 0751, got %s", info.Mode().Perm())
+		}
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		if err := fsys.MkdirAll("target", 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.WriteFile("target/data.txt", []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Symlink("target", "link"); err != nil {
+			t.Fatalf("Symlink failed: %v", err)
+		}
+
+		target, err := fsys.ReadLink("link")
+		if err != nil {
+			t.Fatalf("ReadLink failed: %v", err)
+		}
+
+		if target != "target" {
+			t.Fatalf("expected link target %q, got %q", "target", target)
+		}
+
+		info, err := fsys.Lstat("link")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode()&fs.ModeSymlink == 0 {
+			t.Fatal("expected Lstat to report a symlink")
+		}
+
+		data, err := fsys.ReadFile("link/data.txt")
+		if err != nil {
+			t.Fatalf("ReadFile through symlink failed: %v", err)
+		}
+
+		if string(data) != "data" {
+			t.Fatalf("unexpected content %q", data)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := fsys.MkdirAll("rm/sub", 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Remove("rm"); err == nil {
+			t.Fatal("expected error removing non-empty directory")
+		}
+
+		if err := fsys.Remove("rm/sub"); err != nil {
+			t.Fatalf("Remove failed: %v", err)
+		}
+
+		if err := fsys.WriteFile("rm/file.txt", nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.RemoveAll("rm"); err != nil {
+			t.Fatalf("RemoveAll failed: %v", err)
+		}
+
+		if _, err := fsys.Stat("rm"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected ErrNotExist, got %v", err)
+		}
+
+		if err := fsys.RemoveAll("rm"); err != nil {
+			t.Fatalf("RemoveAll of missing path failed: %v", err)
+		}
+	})
+
+	t.Run("read dir", func(t *testing.T) {
+		if err := fsys.MkdirAll("list", 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"list/b", "list/a", "list/c"} {
+			if err := fsys.WriteFile(name, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		entries, err := fsys.ReadDir("list")
+		if err != nil {
+			t.Fatalf("ReadDir failed: %v", err)
+		}
+
+		if len(entries) != 3 || entries[0].Name() != "a" || entries[2].Name() != "c" {
+			t.Fatalf("unexpected entries: %v", entries)
+		}
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		for _, name := range []string{"../escape", "/abs", "a/../../b"} {
+			if err := fsys.WriteFile(name, nil, 0o644); err == nil {
+				t.Fatalf("expected error writing %q", name)
+			}
+		}
+	})
+}
+
+func TestRootFSSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := NewRootFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	if _, err := root.ReadFile("escape/secret"); err == nil {
+		t.Fatal("expected error reading through escaping symlink")
+	}
+
+	if err := root.WriteFile("escape/new", nil, 0o644); err == nil {
+		t.Fatal("expected error writing through escaping symlink")
+	}
+
+	// the plain OS filesystem follows the link
+	if _, err := NewOSFS(dir).ReadFile("escape/secret"); err != nil {
+		t.Fatalf("expected OSFS to follow symlink: %v", err)
+	}
+}
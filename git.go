@@ -0,0 +1,359 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GitCloneSpec ensures a git repository is cloned into the project.
+type GitCloneSpec struct {
+	// repository to clone; defaults to the project URL
+	URL string `yaml:"url"`
+
+	// clone destination; defaults to the project path
+	Dir string `yaml:"dir"`
+
+	// optional branch to check out when cloning
+	Branch string `yaml:"branch"`
+}
+
+// GitCheckoutSpec ensures a branch or ref is checked out.
+type GitCheckoutSpec struct {
+	// branch, tag or commit to check out
+	Ref string `yaml:"ref"`
+
+	// repository directory; defaults to the project path
+	Dir string `yaml:"dir"`
+}
+
+// GitRemoteSpec ensures a remote is configured with the given URL.
+type GitRemoteSpec struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+
+	// repository directory; defaults to the project path
+	Dir string `yaml:"dir"`
+}
+
+// GitConfigSpec ensures a local git config key is set.
+type GitConfigSpec struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+
+	// repository directory; defaults to the project path
+	Dir string `yaml:"dir"`
+}
+
+// GitCloneSpec methods
+func (s *GitCloneSpec) Check(project *Project) (bool, error) {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return false, err
+	}
+
+	return isGitRepo(dir)
+}
+
+func (s *GitCloneSpec) Apply(project *Project) error {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	url := s.URL
+	if url == "" {
+		url = project.URL
+	}
+
+	if url == "" {
+		return fmt.Errorf("no repository URL for project %s", project.Name)
+	}
+
+	args := []string{"clone"}
+	if s.Branch != "" {
+		args = append(args, "--branch", s.Branch)
+	}
+	args = append(args, "--", url, dir)
+
+	_, err = runGit(project, "", args...)
+	return err
+}
+
+// the clone directory; see IdentifiableSpec
+func (s *GitCloneSpec) Resource() string {
+	return s.Dir
+}
+
+func (s *GitCloneSpec) String() string {
+	return describeFields("git-clone", s.URL, s.Dir)
+}
+
+// GitCheckoutSpec methods
+func (s *GitCheckoutSpec) Check(project *Project) (bool, error) {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return false, err
+	}
+
+	// if the ref names a local branch, it must be the current branch
+	if _, err := runGit(project, dir, "show-ref", "--verify", "--quiet", "refs/heads/"+s.Ref); err == nil {
+		branch, err := runGit(project, dir, "symbolic-ref", "--quiet", "--short", "HEAD")
+		if err != nil {
+			return false, nil
+		}
+		return branch == s.Ref, nil
+	}
+
+	head, err := runGit(project, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return false, err
+	}
+
+	want, err := runGit(project, dir, "rev-parse", "--verify", "--quiet", s.Ref+"^{commit}")
+	if err != nil {
+		// unknown refs (e.g. a remote branch not yet checked out) need to be applied
+		return false, nil
+	}
+
+	return head == want, nil
+}
+
+func (s *GitCheckoutSpec) Apply(project *Project) error {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(project, dir, "checkout", s.Ref)
+	return err
+}
+
+// the checkout directory; see IdentifiableSpec
+func (s *GitCheckoutSpec) Resource() string {
+	return s.Dir
+}
+
+func (s *GitCheckoutSpec) String() string {
+	return describeFields("git-checkout", s.Ref, s.Dir)
+}
+
+// GitRemoteSpec methods
+func (s *GitRemoteSpec) Check(project *Project) (bool, error) {
+	url, ok, err := s.current(project)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return url == s.URL, nil
+}
+
+func (s *GitRemoteSpec) Apply(project *Project) error {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	_, exists, err := s.current(project)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		_, err = runGit(project, dir, "remote", "set-url", s.Name, s.URL)
+	} else {
+		_, err = runGit(project, dir, "remote", "add", s.Name, s.URL)
+	}
+
+	return err
+}
+
+func (s *GitRemoteSpec) Exists(project *Project) (bool, error) {
+	_, exists, err := s.current(project)
+	return exists, err
+}
+
+func (s *GitRemoteSpec) Remove(project *Project) error {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(project, dir, "remote", "remove", s.Name)
+	return err
+}
+
+// the remote in the repository; see IdentifiableSpec
+func (s *GitRemoteSpec) Resource() string {
+	return s.Dir + ":" + s.Name
+}
+
+func (s *GitRemoteSpec) String() string {
+	return describeFields("git-remote", s.Name, s.Dir)
+}
+
+// returns the current URL of the remote and whether it exists
+func (s *GitRemoteSpec) current(project *Project) (string, bool, error) {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return "", false, err
+	}
+
+	remotes, err := runGit(project, dir, "remote")
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, name := range strings.Fields(remotes) {
+		if name == s.Name {
+			url, err := runGit(project, dir, "remote", "get-url", s.Name)
+			return url, true, err
+		}
+	}
+
+	return "", false, nil
+}
+
+// GitConfigSpec methods
+func (s *GitConfigSpec) Check(project *Project) (bool, error) {
+	value, ok, err := s.current(project)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return value == s.Value, nil
+}
+
+func (s *GitConfigSpec) Apply(project *Project) error {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(project, dir, "config", "--local", s.Key, s.Value)
+	return err
+}
+
+func (s *GitConfigSpec) Exists(project *Project) (bool, error) {
+	_, exists, err := s.current(project)
+	return exists, err
+}
+
+func (s *GitConfigSpec) Remove(project *Project) error {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(project, dir, "config", "--local", "--unset-all", s.Key)
+	return err
+}
+
+// the config key in the repository; see IdentifiableSpec
+func (s *GitConfigSpec) Resource() string {
+	return s.Dir + ":" + s.Key
+}
+
+func (s *GitConfigSpec) String() string {
+	return describeFields("git-config", s.Key, s.Dir)
+}
+
+// returns the current value of the config key and whether it is set
+func (s *GitConfigSpec) current(project *Project) (string, bool, error) {
+	dir, err := project.HostPath(s.Dir)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, err := runGit(project, dir, "config", "--local", "--get", s.Key)
+
+	// git config exits with status 1 when the key is not set
+	var execErr *ExecError
+	if errors.As(err, &execErr) && execErr.Result.ExitCode == 1 {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// helper to determine if the directory is the top level of a git work tree.
+// git always runs against the host filesystem, so git specs do not use the
+// project FS.
+func isGitRepo(dir string) (bool, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if !info.IsDir() {
+		return false, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+	if err != nil {
+		return false, nil
+	}
+
+	toplevel := strings.TrimSpace(string(output))
+	return sameFile(toplevel, dir), nil
+}
+
+// helper to compare paths that may differ only by symlinks
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(ai, bi)
+}
+
+// run a git command in dir and return its trimmed stdout
+func runGit(project *Project, dir string, args ...string) (string, error) {
+	command := append([]string{"git"}, args...)
+	result := &ExecResult{Command: command, Dir: dir, ExitCode: -1}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Trace().Str("project", project.Name).Strs("command", command).Str("dir", dir).Msg("Running git")
+
+	start := time.Now()
+	err := cmd.Run()
+	result.Duration = time.Since(start)
+	result.Output = stdout.String() + stderr.String()
+
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if err != nil {
+		return "", &ExecError{Result: result, Err: err}
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
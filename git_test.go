@@ -0,0 +1,320 @@
+package spec
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitCloneSpec(t *testing.T) {
+	origin := newTestOrigin(t)
+
+	t.Run("clone from spec url", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "repo")
+		spec := &GitCloneSpec{URL: origin}
+		project := NewProject("test").WithPath(dir).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false before clone")
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		ok, err = spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected Check to return true after clone")
+		}
+	})
+
+	t.Run("clone from project url", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "repo")
+		spec := &GitCloneSpec{}
+		project := NewProject("test").WithPath(dir).WithHomepage(origin).WithSpec(spec).Build()
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		if ok, _ := isGitRepo(dir); !ok {
+			t.Fatal("expected repository to be cloned")
+		}
+	})
+
+	t.Run("clone without url", func(t *testing.T) {
+		spec := &GitCloneSpec{}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		if err := spec.Apply(project); err == nil {
+			t.Fatal("expected error without URL")
+		}
+	})
+
+	t.Run("subdirectory of repo is not a clone", func(t *testing.T) {
+		dir := cloneTestOrigin(t, origin)
+		spec := &GitCloneSpec{Dir: "docs"}
+		project := NewProject("test").WithPath(dir).Build()
+
+		if err := os.Mkdir(filepath.Join(dir, "docs"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false for a subdirectory")
+		}
+	})
+}
+
+func TestGitSpecsRequireHostFS(t *testing.T) {
+	project := NewProject("test").WithFS(NewMemFS()).Build()
+
+	specs := []Specification{
+		&GitCloneSpec{URL: "file:///missing.git"},
+		&GitCheckoutSpec{Ref: "main"},
+		&GitRemoteSpec{Name: "origin", URL: "file:///missing.git"},
+		&GitConfigSpec{Key: "core.autocrlf", Value: "input"},
+	}
+
+	for _, spec := range specs {
+		if _, err := spec.Check(project); !errors.Is(err, ErrNotHostFS) {
+			t.Fatalf("expected Check of %T to require the host filesystem, got %v", spec, err)
+		}
+
+		if err := spec.Apply(project); !errors.Is(err, ErrNotHostFS) {
+			t.Fatalf("expected Apply of %T to require the host filesystem, got %v", spec, err)
+		}
+	}
+
+	dir := t.TempDir()
+	hosted := NewProject("test").WithPath(dir).WithFS(NewOSFS(dir)).Build()
+	if _, err := (&GitConfigSpec{Key: "core.autocrlf"}).Check(hosted); errors.Is(err, ErrNotHostFS) {
+		t.Fatal("expected a host filesystem at the project root to be allowed")
+	}
+}
+
+func TestGitCheckoutSpec(t *testing.T) {
+	origin := newTestOrigin(t)
+
+	t.Run("checkout remote branch", func(t *testing.T) {
+		dir := cloneTestOrigin(t, origin)
+		spec := &GitCheckoutSpec{Ref: "feature"}
+		project := NewProject("test").WithPath(dir).WithSpec(spec).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false before checkout")
+		}
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		ok, err = spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected Check to return true after checkout")
+		}
+	})
+
+	t.Run("current branch", func(t *testing.T) {
+		dir := cloneTestOrigin(t, origin)
+		spec := &GitCheckoutSpec{Ref: "main"}
+		project := NewProject("test").WithPath(dir).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected Check to return true for current branch")
+		}
+	})
+
+	t.Run("checkout tag", func(t *testing.T) {
+		dir := cloneTestOrigin(t, origin)
+		spec := &GitCheckoutSpec{Ref: "v1.0"}
+		project := NewProject("test").WithPath(dir).WithSpec(spec).Build()
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected Check to return true after checkout")
+		}
+	})
+}
+
+func TestGitRemoteSpec(t *testing.T) {
+	origin := newTestOrigin(t)
+	dir := cloneTestOrigin(t, origin)
+	project := NewProject("test").WithPath(dir).Build()
+
+	t.Run("existing remote", func(t *testing.T) {
+		spec := &GitRemoteSpec{Name: "origin", URL: origin}
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if !ok {
+			t.Fatal("expected Check to return true")
+		}
+	})
+
+	t.Run("add and remove remote", func(t *testing.T) {
+		spec := &GitRemoteSpec{Name: "upstream", URL: origin}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		ok, err := spec.Check(project)
+		if err != nil || !ok {
+			t.Fatal("expected remote to be added")
+		}
+
+		if err := spec.Remove(project); err != nil {
+			t.Fatalf("Remove failed: %v", err)
+		}
+
+		exists, err := spec.Exists(project)
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+
+		if exists {
+			t.Fatal("expected remote to be removed")
+		}
+	})
+
+	t.Run("update remote url", func(t *testing.T) {
+		spec := &GitRemoteSpec{Name: "origin", URL: "file:///tmp/other.git"}
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false for a different URL")
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		if ok, _ := spec.Check(project); !ok {
+			t.Fatal("expected remote URL to be updated")
+		}
+	})
+}
+
+func TestGitConfigSpec(t *testing.T) {
+	origin := newTestOrigin(t)
+	dir := cloneTestOrigin(t, origin)
+	project := NewProject("test").WithPath(dir).Build()
+
+	spec := &GitConfigSpec{Key: "core.autocrlf", Value: "input"}
+
+	ok, err := spec.Check(project)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	if ok {
+		t.Fatal("expected Check to return false for unset key")
+	}
+
+	if err := spec.Apply(project); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if ok, _ := spec.Check(project); !ok {
+		t.Fatal("expected config key to be set")
+	}
+
+	if err := spec.Remove(project); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	if exists, _ := spec.Exists(project); exists {
+		t.Fatal("expected config key to be removed")
+	}
+}
+
+// Test helpers
+
+// create a bare repository with a main branch, a feature branch and a tag
+func newTestOrigin(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "origin.git")
+	work := filepath.Join(root, "work")
+
+	runTestGit(t, root, "init", "-q", "--bare", "-b", "main", bare)
+	runTestGit(t, root, "init", "-q", "-b", "main", work)
+	runTestGit(t, work, "commit", "-q", "--allow-empty", "-m", "initial")
+	runTestGit(t, work, "tag", "v1.0")
+	runTestGit(t, work, "commit", "-q", "--allow-empty", "-m", "second")
+	runTestGit(t, work, "branch", "feature")
+	runTestGit(t, work, "push", "-q", bare, "main", "feature", "v1.0")
+
+	return "file://" + bare
+}
+
+func cloneTestOrigin(t *testing.T, origin string) string {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	runTestGit(t, "", "clone", "-q", origin, dir)
+	return dir
+}
+
+func runTestGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+}
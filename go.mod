@@ -2,10 +2,17 @@ module github.com/jheddings/go-spec
 
 go 1.25.4
 
-require github.com/rs/zerolog v1.34.0
+require (
+	github.com/klauspost/compress v1.20.1
+	github.com/rs/zerolog v1.34.0
+	github.com/spf13/cobra v1.10.2
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/spf13/pflag v1.0.9 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 )
@@ -0,0 +1,171 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot is returned when a spec path resolves outside the project root.
+var ErrOutsideRoot = errors.New("path escapes project root")
+
+// UnrestrictedSpec allows the wrapped spec to access paths outside the
+// project root.  use it only for specs that legitimately manage files
+// elsewhere, such as user-level config files.
+type UnrestrictedSpec struct {
+	Spec Specification
+}
+
+func Unrestricted(spec Specification) *UnrestrictedSpec {
+	return &UnrestrictedSpec{Spec: spec}
+}
+
+func (u *UnrestrictedSpec) Check(project *Project) (bool, error) {
+	return u.Spec.Check(project.unrestricted())
+}
+
+func (u *UnrestrictedSpec) Apply(project *Project) error {
+	return u.Spec.Apply(project.unrestricted())
+}
+
+func (u *UnrestrictedSpec) Diff(project *Project) (string, error) {
+	return specDiff(project.unrestricted(), u.Spec)
+}
+
+func (u *UnrestrictedSpec) Exists(project *Project) (bool, error) {
+	return specExists(project.unrestricted(), u.Spec)
+}
+
+func (u *UnrestrictedSpec) Remove(project *Project) error {
+	return specRemove(project.unrestricted(), u.Spec)
+}
+
+func (u *UnrestrictedSpec) Equals(project *Project) (bool, error) {
+	return specEquals(project.unrestricted(), u.Spec)
+}
+
+func (u *UnrestrictedSpec) Replace(project *Project) error {
+	return specReplace(project.unrestricted(), u.Spec)
+}
+
+func (u *UnrestrictedSpec) Snapshot(project *Project) (Snapshot, error) {
+	snapshot, err := snapshotSpec(project.unrestricted(), u.Spec)
+	if snapshot == nil || err != nil {
+		return nil, err
+	}
+	return &unrestrictedSnapshot{snapshot}, nil
+}
+
+// restores the wrapped snapshot with paths outside the root allowed
+type unrestrictedSnapshot struct {
+	Snapshot
+}
+
+func (u *unrestrictedSnapshot) Restore(project *Project) error {
+	return u.Snapshot.Restore(project.unrestricted())
+}
+
+// returns a shallow copy of the project that allows paths outside the root
+func (p *Project) unrestricted() *Project {
+	clone := *p
+	clone.UnrestrictedPaths = true
+	clone.origin = p.original()
+	return &clone
+}
+
+// the project that copies such as unrestricted() were made from
+func (p *Project) original() *Project {
+	if p.origin != nil {
+		return p.origin
+	}
+	return p
+}
+
+// the parts of a filesystem needed to follow symlinks
+type linkReader interface {
+	Lstat(name string) (fs.FileInfo, error)
+	ReadLink(name string) (string, error)
+}
+
+// verify that following symlinks in name never leaves the root of fsys.  abs
+// converts an absolute link target into a name in fsys, returning false if
+// the target is outside the root.  ".." in link targets is applied to the
+// directory the link resolves through, not lexically, so chained links such
+// as a -> b/link/.. are followed the way the OS follows them.
+func checkSymlinks(fsys linkReader, name string, abs func(string) (string, bool)) error {
+	pending := splitName(name)
+	current := "."
+	hops := 0
+
+	for len(pending) > 0 {
+		elem := pending[0]
+		pending = pending[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if current == "." {
+				return ErrOutsideRoot
+			}
+			current = path.Dir(current)
+			continue
+		}
+
+		next := path.Join(current, elem)
+
+		// anything that cannot be inspected does not exist yet (or will fail
+		// when it is used), so there is nothing further to follow
+		info, err := fsys.Lstat(next)
+		if err != nil {
+			return nil
+		}
+
+		if info.Mode()&fs.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		if hops++; hops > maxSymlinkHops {
+			return errLoop
+		}
+
+		link, err := fsys.ReadLink(next)
+		if err != nil {
+			return err
+		}
+
+		// relative targets continue from the directory holding the link
+		if filepath.IsAbs(link) || path.IsAbs(filepath.ToSlash(link)) {
+			resolved, ok := abs(link)
+			if !ok {
+				return ErrOutsideRoot
+			}
+			pending = append(splitName(resolved), pending...)
+			current = "."
+		} else {
+			pending = append(strings.Split(filepath.ToSlash(link), "/"), pending...)
+		}
+	}
+
+	return nil
+}
+
+// convert an absolute host path to a name relative to root, if it is inside
+func hostRel(root, target string) (string, bool) {
+	roots := []string{root}
+	if real, err := filepath.EvalSymlinks(root); err == nil && real != root {
+		roots = append(roots, real)
+	}
+
+	for _, base := range roots {
+		rel, err := filepath.Rel(base, filepath.Clean(target))
+		if err == nil && filepath.IsLocal(rel) {
+			return filepath.ToSlash(rel), true
+		}
+	}
+
+	return "", false
+}
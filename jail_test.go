@@ -0,0 +1,150 @@
+package spec
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathJail(t *testing.T) {
+	t.Run("parent traversal", func(t *testing.T) {
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		if _, _, err := project.ResolveFS("../outside.txt"); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("expected ErrOutsideRoot, got %v", err)
+		}
+	})
+
+	t.Run("host symlink escape", func(t *testing.T) {
+		dir := t.TempDir()
+		outside := t.TempDir()
+		if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		project := NewProject("test").WithPath(dir).Build()
+
+		if _, err := project.ResolvePath("link/file.txt"); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("expected ErrOutsideRoot, got %v", err)
+		}
+
+		if _, _, err := project.ResolveFS("link/file.txt"); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("expected ErrOutsideRoot, got %v", err)
+		}
+	})
+
+	t.Run("host relative symlink escape", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("../..", filepath.Join(dir, "sub", "up")); err != nil {
+			t.Fatal(err)
+		}
+
+		project := NewProject("test").WithPath(dir).Build()
+
+		if _, _, err := project.ResolveFS("sub/up/etc"); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("expected ErrOutsideRoot, got %v", err)
+		}
+	})
+
+	t.Run("host symlink inside root", func(t *testing.T) {
+		dir := writeTestTree(t, map[string]string{"real/file.txt": "ok"})
+		if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "abs")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("real", filepath.Join(dir, "rel")); err != nil {
+			t.Fatal(err)
+		}
+
+		project := NewProject("test").WithPath(dir).Build()
+
+		for _, name := range []string{"abs/file.txt", "rel/file.txt"} {
+			if _, _, err := project.ResolveFS(name); err != nil {
+				t.Fatalf("ResolveFS failed for %s: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("memfs symlink escape", func(t *testing.T) {
+		fsys := NewMemFS()
+		if err := fsys.MkdirAll("data", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Symlink("../..", "data/up"); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Symlink("/data", "abs"); err != nil {
+			t.Fatal(err)
+		}
+
+		project := NewProject("test").WithPath("/proj").WithFS(fsys).Build()
+
+		if _, _, err := project.ResolveFS("data/up/x"); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("expected ErrOutsideRoot, got %v", err)
+		}
+
+		if _, _, err := project.ResolveFS("abs/x"); err != nil {
+			t.Fatalf("ResolveFS failed: %v", err)
+		}
+	})
+
+	t.Run("spec refuses escape", func(t *testing.T) {
+		dir := t.TempDir()
+		spec := &EnvFileSpec{Path: "../.env", Key: "A", Value: "1"}
+		project := NewProject("test").WithPath(dir).WithSpec(spec).Build()
+
+		if err := project.BuildAll(); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("expected ErrOutsideRoot, got %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dir), ".env")); !os.IsNotExist(err) {
+			t.Fatal("expected no file outside the project root")
+		}
+	})
+}
+
+func TestUnrestrictedSpec(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "proj")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &EnvFileSpec{Path: "../shared.env", Key: "A", Value: "1"}
+	project := NewProject("test").WithPath(dir).WithSpec(Unrestricted(spec)).Build()
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(parent, "shared.env"))
+	if err != nil {
+		t.Fatalf("expected file outside project root: %v", err)
+	}
+
+	if string(data) != "A=1\n" {
+		t.Fatalf("unexpected env file: %q", data)
+	}
+
+	if project.UnrestrictedPaths {
+		t.Fatal("expected project to remain restricted")
+	}
+	t.Run("modes without removal or replacement", func(t *testing.T) {
+		plain := Unrestricted(&TestApplyErrorSpec{})
+
+		if ok, err := (&RemoveSpec{Spec: plain}).Check(project); err != nil || !ok {
+			t.Fatalf("expected the inverted Check fallback for removal, got %v (%v)", ok, err)
+		}
+
+		if ok, err := (&ReplaceSpec{Spec: plain}).Check(project); err != nil || ok {
+			t.Fatalf("expected the Check fallback for replacement, got %v (%v)", ok, err)
+		}
+
+		if err := plain.Remove(project); err == nil {
+			t.Fatal("expected error for a spec that does not support removal")
+		}
+	})
+}
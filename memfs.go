@@ -0,0 +1,518 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maximum number of symlinks followed when resolving a name
+const maxSymlinkHops = 40
+
+var (
+	errNotDir   = errors.New("not a directory")
+	errIsDir    = errors.New("is a directory")
+	errNotEmpty = errors.New("directory not empty")
+	errLoop     = errors.New("too many levels of symbolic links")
+)
+
+// MemFS is an in-memory WritableFS, primarily intended for tests.
+type MemFS struct {
+	lock  sync.RWMutex
+	nodes map[string]*memNode
+}
+
+type memNode struct {
+	mode    fs.FileMode
+	data    []byte
+	target  string
+	modTime time.Time
+	uid     int
+	gid     int
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		nodes: map[string]*memNode{
+			".": {mode: fs.ModeDir | 0o755, modTime: time.Now()},
+		},
+	}
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	resolved, node, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &memFile{info: newMemInfo(name, node)}
+	if node.mode.IsDir() {
+		file.entries = m.children(resolved)
+	} else {
+		file.reader = bytes.NewReader(slices.Clone(node.data))
+	}
+
+	return file, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, node, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return newMemInfo(name, node), nil
+}
+
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, node, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return newMemInfo(name, node), nil
+}
+
+func (m *MemFS) ReadLink(name string) (string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, node, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return node.target, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, node, err := m.lookup("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+
+	return slices.Clone(node.data), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	resolved, node, err := m.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	return m.children(resolved), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	resolved, err := m.resolve("writefile", name, true)
+	if err != nil {
+		return err
+	}
+
+	if node, ok := m.nodes[resolved]; ok {
+		if node.mode.IsDir() {
+			return &fs.PathError{Op: "writefile", Path: name, Err: errIsDir}
+		}
+		node.data = slices.Clone(data)
+		node.modTime = time.Now()
+		return nil
+	}
+
+	if err := m.checkParent("writefile", name, resolved); err != nil {
+		return err
+	}
+
+	m.nodes[resolved] = &memNode{
+		mode:    perm & permMask,
+		data:    slices.Clone(data),
+		modTime: time.Now(),
+	}
+
+	return nil
+}
+
+func (m *MemFS) Mkdir(name string, perm fs.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.mkdir(name, perm)
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	current := "."
+	for _, part := range splitName(name) {
+		current = path.Join(current, part)
+
+		_, node, err := m.lookup("mkdir", current, true)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := m.mkdir(current, perm); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if !node.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: current, Err: errNotDir}
+		}
+	}
+
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	resolved, node, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+
+	if resolved == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if node.mode.IsDir() && len(m.children(resolved)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+
+	delete(m.nodes, resolved)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	resolved, err := m.resolve("removeall", name, false)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if resolved == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+
+	prefix := resolved + "/"
+	for key := range m.nodes {
+		if key == resolved || strings.HasPrefix(key, prefix) {
+			delete(m.nodes, key)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemFS) Symlink(target, name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	resolved, err := m.resolve("symlink", name, false)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := m.nodes[resolved]; ok {
+		return &fs.PathError{Op: "symlink", Path: name, Err: fs.ErrExist}
+	}
+
+	if err := m.checkParent("symlink", name, resolved); err != nil {
+		return err
+	}
+
+	m.nodes[resolved] = &memNode{
+		mode:    fs.ModeSymlink | 0o777,
+		target:  target,
+		modTime: time.Now(),
+	}
+
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, node, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+
+	node.mode = node.mode&fs.ModeType | mode&permMask
+	return nil
+}
+
+func (m *MemFS) Lchown(name string, uid, gid int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, node, err := m.lookup("lchown", name, false)
+	if err != nil {
+		return err
+	}
+
+	if uid >= 0 {
+		node.uid = uid
+	}
+
+	if gid >= 0 {
+		node.gid = gid
+	}
+
+	return nil
+}
+
+// create a single directory; the caller must hold the write lock
+func (m *MemFS) mkdir(name string, perm fs.FileMode) error {
+	resolved, err := m.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := m.nodes[resolved]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	if err := m.checkParent("mkdir", name, resolved); err != nil {
+		return err
+	}
+
+	m.nodes[resolved] = &memNode{
+		mode:    fs.ModeDir | perm&permMask,
+		modTime: time.Now(),
+	}
+
+	return nil
+}
+
+// verify the parent of a resolved name exists and is a directory
+func (m *MemFS) checkParent(op, name, resolved string) error {
+	parent, ok := m.nodes[path.Dir(resolved)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+
+	return nil
+}
+
+// resolve a name and return the existing node it refers to
+func (m *MemFS) lookup(op, name string, follow bool) (string, *memNode, error) {
+	resolved, err := m.resolve(op, name, follow)
+	if err != nil {
+		return "", nil, err
+	}
+
+	node, ok := m.nodes[resolved]
+	if !ok {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return resolved, node, nil
+}
+
+// resolve symlinks in a name; the final element need not exist, and is only
+// followed if it is a symlink and follow is set
+func (m *MemFS) resolve(op, name string, follow bool) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	parts := splitName(name)
+	current := "."
+	hops := 0
+
+	for len(parts) > 0 {
+		next := path.Join(current, parts[0])
+		parts = parts[1:]
+
+		node, ok := m.nodes[next]
+		if !ok {
+			if len(parts) == 0 {
+				return next, nil
+			}
+			return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+
+		if node.mode&fs.ModeSymlink != 0 && (len(parts) > 0 || follow) {
+			if hops++; hops > maxSymlinkHops {
+				return "", &fs.PathError{Op: op, Path: name, Err: errLoop}
+			}
+
+			// absolute targets are relative to the root of the filesystem
+			base := current
+			if strings.HasPrefix(node.target, "/") {
+				base = "."
+			}
+
+			target := path.Join(base, strings.TrimPrefix(node.target, "/"))
+			if !fs.ValidPath(target) {
+				return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+			}
+
+			parts = append(splitName(target), parts...)
+			current = "."
+			continue
+		}
+
+		if len(parts) > 0 && !node.mode.IsDir() {
+			return "", &fs.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+
+		current = next
+	}
+
+	return current, nil
+}
+
+// list the entries of a resolved directory, sorted by name
+func (m *MemFS) children(dir string) []fs.DirEntry {
+	entries := []fs.DirEntry{}
+	for key, node := range m.nodes {
+		if key != "." && path.Dir(key) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(newMemInfo(key, node)))
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries
+}
+
+func splitName(name string) []string {
+	if name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// memInfo is a point-in-time snapshot of a node
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	uid     int
+	gid     int
+}
+
+func newMemInfo(name string, node *memNode) *memInfo {
+	return &memInfo{
+		name:    path.Base(name),
+		size:    int64(len(node.data)),
+		mode:    node.mode,
+		modTime: node.modTime,
+		uid:     node.uid,
+		gid:     node.gid,
+	}
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() any           { return nil }
+
+// ownership of the file, used in place of platform stat info
+func (i *memInfo) Owner() (int, int) { return i.uid, i.gid }
+
+// memFile is an open file or directory from a MemFS
+type memFile struct {
+	info    *memInfo
+	reader  *bytes.Reader
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memFile) Read(buf []byte) (int, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: errIsDir}
+	}
+	return f.reader.Read(buf)
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: errIsDir}
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *memFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if f.reader != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: f.info.name, Err: errNotDir}
+	}
+
+	remaining := f.entries[f.offset:]
+	if count <= 0 {
+		f.offset = len(f.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	count = min(count, len(remaining))
+	f.offset += count
+	return remaining[:count], nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
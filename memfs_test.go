@@ -0,0 +1,112 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestMemFSSymlinks(t *testing.T) {
+	fsys := NewMemFS()
+
+	if err := fsys.MkdirAll("data/nested", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.WriteFile("data/nested/file.txt", []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("relative chain", func(t *testing.T) {
+		if err := fsys.Symlink("nested", "data/link"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Symlink("data/link", "top"); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := fsys.ReadFile("top/file.txt")
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		if string(data) != "ok" {
+			t.Fatalf("unexpected content %q", data)
+		}
+	})
+
+	t.Run("absolute target", func(t *testing.T) {
+		if err := fsys.Symlink("/data/nested/file.txt", "abs"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fsys.ReadFile("abs"); err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+	})
+
+	t.Run("escaping target", func(t *testing.T) {
+		if err := fsys.Symlink("../outside", "escape"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fsys.ReadFile("escape"); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatalf("expected ErrInvalid, got %v", err)
+		}
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		if err := fsys.Symlink("loop-b", "loop-a"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Symlink("loop-a", "loop-b"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fsys.Stat("loop-a"); err == nil {
+			t.Fatal("expected error for symlink loop")
+		}
+	})
+
+	t.Run("remove link only", func(t *testing.T) {
+		if err := fsys.Symlink("data", "rm-link"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.RemoveAll("rm-link"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fsys.Stat("data/nested/file.txt"); err != nil {
+			t.Fatal("expected link target to survive RemoveAll")
+		}
+	})
+}
+
+func TestMemFSOwner(t *testing.T) {
+	fsys := NewMemFS()
+
+	if err := fsys.WriteFile("file", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.Lchown("file", 10, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fsys.Lstat("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		t.Fatal("expected owner info")
+	}
+
+	if uid != 10 || gid != 0 {
+		t.Fatalf("expected owner 10:0, got %d:%d", uid, gid)
+	}
+}
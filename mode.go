@@ -39,20 +39,17 @@ func (m *EnsureSpec) Apply(project *Project) error {
 	return m.Spec.Apply(project)
 }
 
-// RemoveSpec methods
-func (m *RemoveSpec) Check(project *Project) (bool, error) {
-	if rm, ok := m.Spec.(RemovableSpec); ok {
-		exists, err := rm.Exists(project)
-		if err != nil {
-			return false, err
-		}
-		return !exists, nil
-	}
+func (m *EnsureSpec) Diff(project *Project) (string, error) {
+	return specDiff(project, m.Spec)
+}
 
-	log.Warn().Type("spec", m.Spec).Msg("Spec does not support removal; using fallback check")
+func (m *EnsureSpec) Snapshot(project *Project) (Snapshot, error) {
+	return snapshotSpec(project, m.Spec)
+}
 
-	// fallback to inverted Check logic
-	exists, err := m.Spec.Check(project)
+// RemoveSpec methods
+func (m *RemoveSpec) Check(project *Project) (bool, error) {
+	exists, err := specExists(project, m.Spec)
 	if err != nil {
 		return false, err
 	}
@@ -61,38 +58,74 @@ func (m *RemoveSpec) Check(project *Project) (bool, error) {
 
 func (m *RemoveSpec) Apply(project *Project) error {
 	log.Trace().Str("project", project.Name).Msg("Applying removal spec")
+	return specRemove(project, m.Spec)
+}
 
-	if rm, ok := m.Spec.(RemovableSpec); ok {
-		return rm.Remove(project)
-	}
-
-	log.Error().Type("spec", m.Spec).Msg("Spec does not support removal")
-	return fmt.Errorf("spec type %T does not support removal", m.Spec)
+func (m *RemoveSpec) Snapshot(project *Project) (Snapshot, error) {
+	return snapshotSpec(project, m.Spec)
 }
 
 // ReplaceSpec methods
 func (m *ReplaceSpec) Check(project *Project) (bool, error) {
-	if repl, ok := m.Spec.(ReplaceableSpec); ok {
-		equal, err := repl.Equals(project)
-		if err != nil {
-			return false, err
-		}
-		return equal, nil
+	return specEquals(project, m.Spec)
+}
+
+func (m *ReplaceSpec) Apply(project *Project) error {
+	log.Trace().Str("project", project.Name).Msg("Applying replacement spec")
+	return specReplace(project, m.Spec)
+}
+
+func (m *ReplaceSpec) Snapshot(project *Project) (Snapshot, error) {
+	return snapshotSpec(project, m.Spec)
+}
+
+// the helpers below forward the optional interfaces to a wrapped spec, so
+// wrappers such as TaggedSpec behave like the spec they wrap
+
+// report whether the spec's resource exists; specs that do not support removal
+// fall back to Check
+func specExists(project *Project, spec Specification) (bool, error) {
+	if rm, ok := spec.(RemovableSpec); ok {
+		return rm.Exists(project)
 	}
 
-	log.Warn().Type("spec", m.Spec).Msg("Spec does not support replacement; using fallback check")
+	log.Warn().Type("spec", spec).Msg("Spec does not support removal; using fallback check")
+	return spec.Check(project)
+}
+
+// report whether the spec's resource matches; specs that do not support
+// replacement fall back to Check
+func specEquals(project *Project, spec Specification) (bool, error) {
+	if repl, ok := spec.(ReplaceableSpec); ok {
+		return repl.Equals(project)
+	}
 
-	// fallback to standard Check logic
-	return m.Spec.Check(project)
+	log.Warn().Type("spec", spec).Msg("Spec does not support replacement; using fallback check")
+	return spec.Check(project)
 }
 
-func (m *ReplaceSpec) Apply(project *Project) error {
-	log.Trace().Str("project", project.Name).Msg("Applying replacement spec")
+func specRemove(project *Project, spec Specification) error {
+	if rm, ok := spec.(RemovableSpec); ok {
+		return rm.Remove(project)
+	}
+
+	log.Error().Type("spec", spec).Msg("Spec does not support removal")
+	return fmt.Errorf("spec type %T does not support removal", spec)
+}
 
-	if repl, ok := m.Spec.(ReplaceableSpec); ok {
+func specReplace(project *Project, spec Specification) error {
+	if repl, ok := spec.(ReplaceableSpec); ok {
 		return repl.Replace(project)
 	}
 
-	log.Error().Type("spec", m.Spec).Msg("Spec does not support replacement")
-	return fmt.Errorf("spec type %T does not support replacement", m.Spec)
+	log.Error().Type("spec", spec).Msg("Spec does not support replacement")
+	return fmt.Errorf("spec type %T does not support replacement", spec)
+}
+
+// describe the pending change; specs that can't describe it have no diff
+func specDiff(project *Project, spec Specification) (string, error) {
+	if diff, ok := spec.(DiffableSpec); ok {
+		return diff.Diff(project)
+	}
+	return "", nil
 }
@@ -0,0 +1,175 @@
+package spec
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Observer receives events as projects are built or planned.  callbacks for a
+// project are made from the goroutine running it, in order.
+type Observer interface {
+	OnProjectStart(project *Project)
+	OnSpecCheck(project *Project, spec Specification)
+	OnSpecApply(project *Project, spec Specification)
+	OnSpecResult(project *Project, result SpecResult)
+	OnProjectEnd(project *Project, err error)
+}
+
+// SpecResult describes the outcome of running a single spec.
+type SpecResult struct {
+	Spec     Specification
+	Outcome  Outcome
+	Duration time.Duration
+	Err      error
+
+	// true if Apply was called, so a failure happened while applying
+	Applied bool
+
+	// pending changes, for drifted or applied specs that implement DiffableSpec
+	Diff string
+
+	// number of times Check or Apply was retried after an error
+	Retries int
+}
+
+// BaseObserver implements Observer with no-op callbacks; embed it to handle
+// only some events.
+type BaseObserver struct{}
+
+func (BaseObserver) OnProjectStart(project *Project)                  {}
+func (BaseObserver) OnSpecCheck(project *Project, spec Specification) {}
+func (BaseObserver) OnSpecApply(project *Project, spec Specification) {}
+func (BaseObserver) OnSpecResult(project *Project, result SpecResult) {}
+func (BaseObserver) OnProjectEnd(project *Project, err error)         {}
+
+// LogObserver writes events to the zerolog logger; it is always included.
+type LogObserver struct {
+	BaseObserver
+}
+
+func (LogObserver) OnProjectStart(project *Project) {
+	log.Debug().Str("project", project.Name).Msg("Starting project")
+}
+
+func (LogObserver) OnSpecApply(project *Project, spec Specification) {
+	log.Info().Str("project", project.Name).Type("spec", spec).Msg("Applying")
+}
+
+func (LogObserver) OnSpecResult(project *Project, result SpecResult) {
+	switch result.Outcome {
+	case OutcomeUpToDate:
+		log.Info().Str("project", project.Name).Type("spec", result.Spec).Msg("Skipping; up to date")
+	case OutcomeDrift:
+		log.Info().Str("project", project.Name).Type("spec", result.Spec).Str("diff", result.Diff).Msg("Out of date")
+	case OutcomeFailed:
+		msg := "Failed to check"
+		if result.Applied {
+			msg = "Failed to apply"
+		}
+		log.Warn().Err(result.Err).Str("project", project.Name).Type("spec", result.Spec).Msg(msg)
+	}
+}
+
+func (LogObserver) OnProjectEnd(project *Project, err error) {
+	log.Debug().Err(err).Str("project", project.Name).Msg("Finished project")
+}
+
+// RunOption configures a call to BuildAll or Plan.
+type RunOption func(*runConfig)
+
+type runConfig struct {
+	observers   []Observer
+	prune       bool
+	transaction bool
+
+	// records applied specs; defaults to the project's StateStore
+	state StateStore
+
+	// selects the specs to run; all specs run if nil
+	tags *TagFilter
+
+	// specs applied so far in a transaction
+	applied []appliedSpec
+}
+
+// send events for this run to the observer, in addition to project observers
+func WithObserver(observer Observer) RunOption {
+	return func(cfg *runConfig) {
+		cfg.observers = append(cfg.observers, observer)
+	}
+}
+
+// record the outcome of each spec in the report
+func WithReport(report *Report) RunOption {
+	return WithObserver(report)
+}
+
+// set up the observers for a run; state is only recorded when building
+func (p *Project) newRun(opts []RunOption, build bool) *runConfig {
+	run := &runConfig{observers: []Observer{LogObserver{}}, state: p.State}
+	run.observers = append(run.observers, p.Observers...)
+
+	for _, opt := range opts {
+		opt(run)
+	}
+
+	if run.state != nil && build {
+		run.observers = append(run.observers, &stateRecorder{store: run.state})
+	}
+
+	return run
+}
+
+func (r *runConfig) projectStart(project *Project) {
+	for _, observer := range r.observers {
+		observer.OnProjectStart(project)
+	}
+}
+
+func (r *runConfig) specCheck(project *Project, spec Specification) {
+	for _, observer := range r.observers {
+		observer.OnSpecCheck(project, spec)
+	}
+}
+
+func (r *runConfig) specApply(project *Project, spec Specification) {
+	for _, observer := range r.observers {
+		observer.OnSpecApply(project, spec)
+	}
+}
+
+func (r *runConfig) specResult(project *Project, result SpecResult) {
+	for _, observer := range r.observers {
+		observer.OnSpecResult(project, result)
+	}
+}
+
+func (r *runConfig) projectEnd(project *Project, err error) {
+	for _, observer := range r.observers {
+		observer.OnProjectEnd(project, err)
+	}
+}
+
+// report the remaining specs as skipped after a failure
+func (r *runConfig) skip(project *Project, specs []Specification) {
+	for _, spec := range specs {
+		r.specResult(project, SpecResult{Spec: spec, Outcome: OutcomeSkipped})
+	}
+}
+
+// describe the pending change, if the spec supports it
+func diffSpec(project *Project, spec Specification) string {
+	diffable, ok := spec.(DiffableSpec)
+	if !ok {
+		return ""
+	}
+
+	diff, err := diffable.Diff(project)
+	if err != nil {
+		log.Debug().Err(err).Str("project", project.Name).Type("spec", spec).Msg("Unable to describe changes")
+		return ""
+	}
+
+	return diff
+}
@@ -0,0 +1,153 @@
+package spec
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestObserverEvents(t *testing.T) {
+	t.Run("build", func(t *testing.T) {
+		events := &TestObserver{}
+		project := NewProject("events").
+			WithSpec(&TestSpec{check: true}).
+			WithSpec(&TestSpec{}).
+			WithSpec(&TestApplyErrorSpec{}).
+			WithSpec(&TestSpec{}).
+			Build()
+
+		if err := project.BuildAll(WithObserver(events)); err == nil {
+			t.Fatal("expected error from BuildAll")
+		}
+
+		expected := []string{
+			"start events",
+			"check *spec.TestSpec",
+			"result *spec.TestSpec ok",
+			"check *spec.TestSpec",
+			"apply *spec.TestSpec",
+			"result *spec.TestSpec applied",
+			"check *spec.TestApplyErrorSpec",
+			"apply *spec.TestApplyErrorSpec",
+			"result *spec.TestApplyErrorSpec failed",
+			"result *spec.TestSpec skipped",
+			"end events apply error",
+		}
+
+		if !reflect.DeepEqual(events.events, expected) {
+			t.Fatalf("unexpected events:\n%v\nexpected:\n%v", events.events, expected)
+		}
+	})
+
+	t.Run("plan", func(t *testing.T) {
+		events := &TestObserver{}
+		project := NewProject("plan").WithSpec(&TestSpec{}).Build()
+
+		if _, err := project.Plan(WithObserver(events)); err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+
+		expected := []string{
+			"start plan",
+			"check *spec.TestSpec",
+			"result *spec.TestSpec drift",
+			"end plan <nil>",
+		}
+
+		if !reflect.DeepEqual(events.events, expected) {
+			t.Fatalf("unexpected events:\n%v\nexpected:\n%v", events.events, expected)
+		}
+	})
+
+	t.Run("project observer", func(t *testing.T) {
+		events := &TestObserver{}
+		project := NewProject("registered").WithObserver(events).WithSpec(&TestSpec{check: true}).Build()
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		if len(events.events) != 4 {
+			t.Fatalf("expected 4 events, got %v", events.events)
+		}
+	})
+}
+
+func TestBaseObserver(t *testing.T) {
+	counter := &TestResultCounter{}
+	project := NewProject("base").WithSpec(&TestSpec{}).WithSpec(&TestSpec{check: true}).Build()
+
+	if err := project.BuildAll(WithObserver(counter)); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	if counter.results != 2 {
+		t.Fatalf("expected 2 results, got %d", counter.results)
+	}
+}
+
+func TestReportConcurrentProjects(t *testing.T) {
+	report := NewReport()
+
+	var wg sync.WaitGroup
+	for idx := range 8 {
+		project := NewProject(fmt.Sprintf("project-%d", idx)).
+			WithSpec(&TestSpec{}).
+			WithSpec(&TestSpec{check: true}).
+			Build()
+
+		wg.Go(func() {
+			if err := project.BuildAll(WithReport(report)); err != nil {
+				t.Errorf("BuildAll failed: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(report.Projects) != 8 {
+		t.Fatalf("expected 8 projects, got %d", len(report.Projects))
+	}
+
+	for _, project := range report.Projects {
+		if len(project.Specs) != 2 {
+			t.Fatalf("expected 2 specs for %s, got %d", project.Name, len(project.Specs))
+		}
+	}
+}
+
+// Test helpers
+
+// records a line for each event
+type TestObserver struct {
+	events []string
+}
+
+func (o *TestObserver) OnProjectStart(project *Project) {
+	o.events = append(o.events, "start "+project.Name)
+}
+
+func (o *TestObserver) OnSpecCheck(project *Project, spec Specification) {
+	o.events = append(o.events, "check "+Describe(spec))
+}
+
+func (o *TestObserver) OnSpecApply(project *Project, spec Specification) {
+	o.events = append(o.events, "apply "+Describe(spec))
+}
+
+func (o *TestObserver) OnSpecResult(project *Project, result SpecResult) {
+	o.events = append(o.events, fmt.Sprintf("result %s %s", Describe(result.Spec), result.Outcome))
+}
+
+func (o *TestObserver) OnProjectEnd(project *Project, err error) {
+	o.events = append(o.events, fmt.Sprintf("end %s %v", project.Name, err))
+}
+
+type TestResultCounter struct {
+	BaseObserver
+	results int
+}
+
+func (o *TestResultCounter) OnSpecResult(project *Project, result SpecResult) {
+	o.results++
+}
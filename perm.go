@@ -0,0 +1,329 @@
+package spec
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// permission bits managed by PermissionSpec
+const permMask = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// PermissionSpec enforces mode bits and ownership on files and directory trees.
+type PermissionSpec struct {
+	// file or directory to manage, relative to the project path
+	Path string `yaml:"path"`
+
+	// mode applied to matching files (and directories, unless DirMode is set)
+	Mode *fs.FileMode `yaml:"mode"`
+
+	// optional mode applied to matching directories
+	DirMode *fs.FileMode `yaml:"dir_mode"`
+
+	// optional ownership; only enforced when running as root
+	UID *int `yaml:"uid"`
+	GID *int `yaml:"gid"`
+
+	// apply to everything below Path as well
+	Recursive bool `yaml:"recursive"`
+
+	// optional glob patterns selecting which paths are managed; patterns
+	// without a separator match the base name (including that of Path
+	// itself), others match the path relative to Path.  a trailing slash
+	// only matches directories, e.g. scripts/
+	Include []string `yaml:"include"`
+}
+
+// PermissionDrift describes a path whose permissions differ from the spec.
+type PermissionDrift struct {
+	Path string
+	name string
+
+	Mode     fs.FileMode
+	WantMode *fs.FileMode
+
+	UID     int
+	GID     int
+	WantUID *int
+	WantGID *int
+}
+
+func (d PermissionDrift) String() string {
+	changes := []string{}
+
+	if d.WantMode != nil {
+		changes = append(changes, fmt.Sprintf("mode %s => %s", d.Mode, *d.WantMode))
+	}
+
+	if d.WantUID != nil {
+		changes = append(changes, fmt.Sprintf("uid %d => %d", d.UID, *d.WantUID))
+	}
+
+	if d.WantGID != nil {
+		changes = append(changes, fmt.Sprintf("gid %d => %d", d.GID, *d.WantGID))
+	}
+
+	return d.Path + ": " + strings.Join(changes, ", ")
+}
+
+func (s *PermissionSpec) Check(project *Project) (bool, error) {
+	drift, err := s.Drift(project)
+	if err != nil {
+		return false, err
+	}
+
+	for _, d := range drift {
+		log.Debug().Str("project", project.Name).Str("drift", d.String()).Msg("Permission drift")
+	}
+
+	return len(drift) == 0, nil
+}
+
+func (s *PermissionSpec) Apply(project *Project) error {
+	fsys, _, err := project.ResolveFS(s.Path)
+	if err != nil {
+		return err
+	}
+
+	drift, err := s.Drift(project)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range drift {
+		log.Debug().Str("project", project.Name).Str("drift", d.String()).Msg("Fixing permissions")
+
+		if d.WantUID != nil || d.WantGID != nil {
+			uid, gid := -1, -1
+			if d.WantUID != nil {
+				uid = *d.WantUID
+			}
+			if d.WantGID != nil {
+				gid = *d.WantGID
+			}
+			if err := fsys.Lchown(d.name, uid, gid); err != nil {
+				return err
+			}
+		}
+
+		// chown may clear setuid / setgid bits, so the mode is applied last
+		if d.WantMode != nil {
+			if err := fsys.Chmod(d.name, *d.WantMode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// record the current permissions of paths that Apply would change
+func (s *PermissionSpec) Snapshot(project *Project) (Snapshot, error) {
+	fsys, _, err := project.ResolveFS(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	drift, err := s.Drift(project)
+	if err != nil {
+		return nil, err
+	}
+
+	return &permSnapshot{fsys: fsys, drift: drift}, nil
+}
+
+// describe the change Apply would make, one path per line
+func (s *PermissionSpec) Diff(project *Project) (string, error) {
+	drift, err := s.Drift(project)
+	if err != nil {
+		return "", err
+	}
+
+	var diff strings.Builder
+	for _, d := range drift {
+		diff.WriteString(d.String())
+		diff.WriteString("\n")
+	}
+
+	return diff.String(), nil
+}
+
+// the managed path; see IdentifiableSpec
+func (s *PermissionSpec) Resource() string {
+	return s.Path
+}
+
+func (s *PermissionSpec) String() string {
+	return describeFields("permission", s.Path)
+}
+
+// returns the paths managed by this spec that do not match the desired state
+func (s *PermissionSpec) Drift(project *Project) ([]PermissionDrift, error) {
+	root, err := project.ResolvePath(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, name, err := project.ResolveFS(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fsys.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := []PermissionDrift{}
+
+	if !s.Recursive || !info.IsDir() {
+		if d, ok := s.compare(root, info); ok && s.matches(".", info.IsDir()) {
+			d.name = name
+			drift = append(drift, d)
+		}
+		return drift, nil
+	}
+
+	err = fs.WalkDir(fsys, name, func(entryName string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel := "."
+		if entryName != name {
+			rel = entryName
+			if name != "." {
+				rel = strings.TrimPrefix(entryName, name+"/")
+			}
+		}
+
+		if !s.matches(rel, entry.IsDir()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if d, ok := s.compare(filepath.Join(root, filepath.FromSlash(rel)), info); ok {
+			d.name = entryName
+			drift = append(drift, d)
+		}
+
+		return nil
+	})
+
+	return drift, err
+}
+
+// determine if the relative path is selected by the include patterns
+func (s *PermissionSpec) matches(rel string, isDir bool) bool {
+	if len(s.Include) == 0 {
+		return true
+	}
+
+	for _, pattern := range s.Include {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+
+		// Path itself is matched by its base name, e.g. *.sh for run.sh
+		if rel == "." {
+			if strings.Contains(pattern, "/") {
+				continue
+			}
+
+			if ok, _ := path.Match(pattern, path.Base(filepath.ToSlash(filepath.Clean(s.Path)))); ok {
+				return true
+			}
+			continue
+		}
+
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compare the path against the spec; returns the drift and true if they differ
+func (s *PermissionSpec) compare(display string, info fs.FileInfo) (PermissionDrift, bool) {
+	drift := PermissionDrift{Path: display, Mode: info.Mode() & permMask}
+
+	// symlink permissions are not meaningful on most platforms
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return drift, false
+	}
+
+	want := s.Mode
+	if info.IsDir() && s.DirMode != nil {
+		want = s.DirMode
+	}
+
+	if want != nil && *want&permMask != drift.Mode {
+		drift.WantMode = Ptr(*want & permMask)
+	}
+
+	if os.Geteuid() == 0 {
+		if uid, gid, ok := fileOwner(info); ok {
+			drift.UID, drift.GID = uid, gid
+
+			if s.UID != nil && *s.UID != uid {
+				drift.WantUID = s.UID
+			}
+
+			if s.GID != nil && *s.GID != gid {
+				drift.WantGID = s.GID
+			}
+		}
+	}
+
+	changed := drift.WantMode != nil || drift.WantUID != nil || drift.WantGID != nil
+	return drift, changed
+}
+
+// restores the permissions recorded before PermissionSpec was applied
+type permSnapshot struct {
+	fsys  WritableFS
+	drift []PermissionDrift
+}
+
+func (s *permSnapshot) Restore(project *Project) error {
+	for _, d := range s.drift {
+		if d.WantUID != nil || d.WantGID != nil {
+			uid, gid := -1, -1
+			if d.WantUID != nil {
+				uid = d.UID
+			}
+			if d.WantGID != nil {
+				gid = d.GID
+			}
+			if err := s.fsys.Lchown(d.name, uid, gid); err != nil {
+				return err
+			}
+		}
+
+		if d.WantMode != nil {
+			if err := s.fsys.Chmod(d.name, d.Mode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package spec
+
+import "io/fs"
+
+// platform file ownership is not supported; only MemFS reports an owner
+func fileOwner(info fs.FileInfo) (int, int, bool) {
+	if owned, ok := info.(interface{ Owner() (int, int) }); ok {
+		uid, gid := owned.Owner()
+		return uid, gid, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,281 @@
+package spec
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPermissionSpec(t *testing.T) {
+	t.Run("single file", func(t *testing.T) {
+		dir := writeTestTree(t, map[string]string{"run.sh": "#!/bin/sh"})
+		spec := &PermissionSpec{Path: "run.sh", Mode: Ptr(fs.FileMode(0o755))}
+		project := NewProject("test").WithPath(dir).Build()
+
+		ok, err := spec.Check(project)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if ok {
+			t.Fatal("expected Check to return false")
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		assertTestMode(t, filepath.Join(dir, "run.sh"), 0o755)
+
+		if ok, _ := spec.Check(project); !ok {
+			t.Fatal("expected Check to return true after apply")
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		spec := &PermissionSpec{Path: "missing", Mode: Ptr(fs.FileMode(0o644))}
+		project := NewProject("test").WithPath(t.TempDir()).Build()
+
+		if _, err := spec.Check(project); err == nil {
+			t.Fatal("expected error for missing path")
+		}
+	})
+
+	t.Run("recursive with dir mode", func(t *testing.T) {
+		dir := writeTestTree(t, map[string]string{
+			"conf/a.txt":     "a",
+			"conf/sub/b.txt": "b",
+		})
+		spec := &PermissionSpec{
+			Path:      "conf",
+			Mode:      Ptr(fs.FileMode(0o600)),
+			DirMode:   Ptr(fs.FileMode(0o700)),
+			Recursive: true,
+		}
+		project := NewProject("test").WithPath(dir).WithSpec(spec).Build()
+
+		drift, err := spec.Drift(project)
+		if err != nil {
+			t.Fatalf("Drift failed: %v", err)
+		}
+
+		if len(drift) != 4 {
+			t.Fatalf("expected 4 drifted paths, got %d", len(drift))
+		}
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		assertTestMode(t, filepath.Join(dir, "conf"), 0o700)
+		assertTestMode(t, filepath.Join(dir, "conf/sub"), 0o700)
+		assertTestMode(t, filepath.Join(dir, "conf/a.txt"), 0o600)
+		assertTestMode(t, filepath.Join(dir, "conf/sub/b.txt"), 0o600)
+	})
+
+	t.Run("recursive with include", func(t *testing.T) {
+		dir := writeTestTree(t, map[string]string{
+			"bin/build.sh":     "",
+			"bin/README":       "",
+			"bin/tools/gen.sh": "",
+		})
+		spec := &PermissionSpec{
+			Path:      "bin",
+			Mode:      Ptr(fs.FileMode(0o755)),
+			Recursive: true,
+			Include:   []string{"*.sh"},
+		}
+		project := NewProject("test").WithPath(dir).Build()
+
+		drift, err := spec.Drift(project)
+		if err != nil {
+			t.Fatalf("Drift failed: %v", err)
+		}
+
+		if len(drift) != 2 {
+			t.Fatalf("expected 2 drifted paths, got %d", len(drift))
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		assertTestMode(t, filepath.Join(dir, "bin/build.sh"), 0o755)
+		assertTestMode(t, filepath.Join(dir, "bin/tools/gen.sh"), 0o755)
+		assertTestMode(t, filepath.Join(dir, "bin/README"), 0o644)
+	})
+
+	t.Run("include on a single path", func(t *testing.T) {
+		dir := writeTestTree(t, map[string]string{"run.sh": "", "bin/README": ""})
+		project := NewProject("test").WithPath(dir).Build()
+
+		spec := &PermissionSpec{Path: "run.sh", Mode: Ptr(fs.FileMode(0o755)), Include: []string{"*.sh"}}
+		if drift, err := spec.Drift(project); err != nil || len(drift) != 1 {
+			t.Fatalf("expected the path to match by its base name, got %d (%v)", len(drift), err)
+		}
+
+		spec.Include = []string{"*.py"}
+		if drift, err := spec.Drift(project); err != nil || len(drift) != 0 {
+			t.Fatalf("expected no drift for a path that is not included, got %d (%v)", len(drift), err)
+		}
+
+		// the root of a recursive walk is included by name as well
+		spec = &PermissionSpec{Path: "bin/", Mode: Ptr(fs.FileMode(0o700)), Recursive: true, Include: []string{"bin"}}
+		if drift, err := spec.Drift(project); err != nil || len(drift) != 1 || drift[0].Path != filepath.Join(dir, "bin") {
+			t.Fatalf("expected only the included root, got %+v (%v)", drift, err)
+		}
+	})
+
+	t.Run("include directories only", func(t *testing.T) {
+		dir := writeTestTree(t, map[string]string{
+			"bin/build.sh":     "",
+			"bin/tools/gen.sh": "",
+			"bin/tools.sh":     "",
+		})
+		spec := &PermissionSpec{
+			Path:      "bin",
+			Mode:      Ptr(fs.FileMode(0o700)),
+			DirMode:   Ptr(fs.FileMode(0o700)),
+			Recursive: true,
+			Include:   []string{"tools*/"},
+		}
+		project := NewProject("test").WithPath(dir).Build()
+
+		drift, err := spec.Drift(project)
+		if err != nil {
+			t.Fatalf("Drift failed: %v", err)
+		}
+
+		if len(drift) != 1 || drift[0].Path != filepath.Join(dir, "bin/tools") {
+			t.Fatalf("expected only the directory to match, got %+v", drift)
+		}
+	})
+
+	t.Run("include with path pattern", func(t *testing.T) {
+		dir := writeTestTree(t, map[string]string{
+			"bin/build.sh":     "",
+			"bin/tools/gen.sh": "",
+		})
+		spec := &PermissionSpec{
+			Path:      "bin",
+			Mode:      Ptr(fs.FileMode(0o700)),
+			Recursive: true,
+			Include:   []string{"tools/*"},
+		}
+		project := NewProject("test").WithPath(dir).Build()
+
+		drift, err := spec.Drift(project)
+		if err != nil {
+			t.Fatalf("Drift failed: %v", err)
+		}
+
+		if len(drift) != 1 {
+			t.Fatalf("expected 1 drifted path, got %d", len(drift))
+		}
+
+		if drift[0].Path != filepath.Join(dir, "bin/tools/gen.sh") {
+			t.Fatalf("unexpected drift path %s", drift[0].Path)
+		}
+	})
+
+	t.Run("ownership", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("ownership requires root")
+		}
+
+		dir := writeTestTree(t, map[string]string{"owned.txt": ""})
+		spec := &PermissionSpec{Path: "owned.txt", UID: Ptr(1), GID: Ptr(1)}
+		project := NewProject("test").WithPath(dir).Build()
+
+		if ok, _ := spec.Check(project); ok {
+			t.Fatal("expected Check to return false")
+		}
+
+		if err := spec.Apply(project); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+
+		if ok, _ := spec.Check(project); !ok {
+			t.Fatal("expected Check to return true after apply")
+		}
+	})
+}
+
+func TestPermissionSpecMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.MkdirAll("secrets/keys", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("secrets/keys/id.pem", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &PermissionSpec{
+		Path:      "secrets",
+		Mode:      Ptr(fs.FileMode(0o600)),
+		DirMode:   Ptr(fs.FileMode(0o700)),
+		Recursive: true,
+	}
+	project := NewProject("test").WithFS(fsys).WithSpec(spec).Build()
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	for name, want := range map[string]fs.FileMode{
+		"secrets":             0o700,
+		"secrets/keys":        0o700,
+		"secrets/keys/id.pem": 0o600,
+	} {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Fatalf("expected %s to have mode %s, got %s", name, want, info.Mode().Perm())
+		}
+	}
+}
+
+// Test helpers
+
+// write files (mode 0644) and parent directories (mode 0755) under a temp dir
+func writeTestTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestTreeAt(t, dir, files)
+	return dir
+}
+
+// write files (mode 0644) and parent directories (mode 0755) below dir
+func writeTestTreeAt(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertTestMode(t *testing.T, path string, want fs.FileMode) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != want {
+		t.Fatalf("expected %s to have mode %s, got %s", path, want, info.Mode().Perm())
+	}
+}
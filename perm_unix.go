@@ -0,0 +1,22 @@
+//go:build unix
+
+package spec
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// helper to read the owner of a file from its platform stat info
+func fileOwner(info fs.FileInfo) (int, int, bool) {
+	if owned, ok := info.(interface{ Owner() (int, int) }); ok {
+		uid, gid := owned.Owner()
+		return uid, gid, true
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
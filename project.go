@@ -1,33 +1,88 @@
 package spec
 
 import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+// ErrNotHostFS is returned by specs that run commands on the host, such as exec
+// and the git specs, in a project whose filesystem is not the host filesystem.
+var ErrNotHostFS = errors.New("exec and git specs require the host filesystem")
+
 type Project struct {
-	Name  string
-	Desc  string
-	Path  string
+	Name string
+	Desc string
+	Path string
+
+	// repository URL, used as the source by GitCloneSpec
 	URL   string
 	Vars  map[string]any
 	Specs []Specification
+
+	// labels for selecting projects, such as team or language; see Selector
+	Labels map[string]string
+
+	// facts detected from the project files, such as its language; see Detect
+	Facts map[string]string
+
+	// filesystem rooted at the project path; defaults to the host filesystem
+	FS WritableFS
+
+	// allow specs to access paths outside the project root
+	UnrestrictedPaths bool
+
+	// observers notified whenever the project is built or planned
+	Observers []Observer
+
+	// optional store recording the specs applied to the project
+	State StateStore
+
+	// optional policy for retrying specs that fail; see RetrySpec
+	Retry *RetryPolicy
+
+	// registry used to identify and recreate specs for the state store;
+	// defaults to the default registry
+	Registry *Registry
+
+	// the project this one was copied from, e.g. by Unrestricted
+	origin *Project
 }
 
 type ProjectBuilder struct {
 	project *Project
 }
 
-var projectsConfig = []Project{}
+// ProjectRegistry holds the projects loaded from config or registered in code,
+// in registration order.  the registry keeps the registered pointers, so
+// projects returned by Get, Filter and Select are the registered projects.
+type ProjectRegistry struct {
+	lock     sync.RWMutex
+	names    []string
+	projects map[string]*projectEntry
+	policy   DuplicatePolicy
+}
+
+type projectEntry struct {
+	project  *Project
+	location string
+}
 
 func NewProject(name string) *ProjectBuilder {
 	return &ProjectBuilder{
 		project: &Project{
-			Name:  name,
-			Desc:  "",
-			Vars:  make(map[string]any),
-			Specs: []Specification{},
+			Name:   name,
+			Desc:   "",
+			Vars:   make(map[string]any),
+			Specs:  []Specification{},
+			Labels: make(map[string]string),
 		},
 	}
 }
@@ -47,11 +102,54 @@ func (p *ProjectBuilder) WithHomepage(url string) *ProjectBuilder {
 	return p
 }
 
+func (p *ProjectBuilder) WithFS(fsys WritableFS) *ProjectBuilder {
+	p.project.FS = fsys
+	return p
+}
+
+func (p *ProjectBuilder) WithUnrestrictedPaths() *ProjectBuilder {
+	p.project.UnrestrictedPaths = true
+	return p
+}
+
+func (p *ProjectBuilder) WithRetry(policy RetryPolicy) *ProjectBuilder {
+	p.project.Retry = &policy
+	return p
+}
+
+func (p *ProjectBuilder) WithRegistry(registry *Registry) *ProjectBuilder {
+	p.project.Registry = registry
+	return p
+}
+
+func (p *ProjectBuilder) WithObserver(observer Observer) *ProjectBuilder {
+	p.project.Observers = append(p.project.Observers, observer)
+	return p
+}
+
+func (p *ProjectBuilder) WithStateStore(store StateStore) *ProjectBuilder {
+	p.project.State = store
+	return p
+}
+
 func (p *ProjectBuilder) WithVar(name string, value any) *ProjectBuilder {
 	p.project.Vars[name] = value
 	return p
 }
 
+func (p *ProjectBuilder) WithLabel(key, value string) *ProjectBuilder {
+	p.project.Labels[key] = value
+	return p
+}
+
+func (p *ProjectBuilder) WithFact(key, value string) *ProjectBuilder {
+	if p.project.Facts == nil {
+		p.project.Facts = make(map[string]string)
+	}
+	p.project.Facts[key] = value
+	return p
+}
+
 func (p *ProjectBuilder) WithSpec(spec Specification) *ProjectBuilder {
 	p.project.Specs = append(p.project.Specs, spec)
 	return p
@@ -70,7 +168,14 @@ func (b *ProjectBuilder) WithSpecReplace(spec Specification) *ProjectBuilder {
 }
 
 func (p *ProjectBuilder) WithBlueprint(bp Blueprint) *ProjectBuilder {
-	p.project.Specs = append(p.project.Specs, bp.Specs...)
+	p.project.Specs = append(p.project.Specs, bp.TaggedSpecs()...)
+	return p
+}
+
+// add the blueprints whose selectors match the facts given so far; see
+// Project.ApplyMatchingBlueprints
+func (p *ProjectBuilder) WithMatchingBlueprints() *ProjectBuilder {
+	p.project.ApplyMatchingBlueprints()
 	return p
 }
 
@@ -78,46 +183,368 @@ func (p *ProjectBuilder) Build() *Project {
 	return p.project
 }
 
-func (p *Project) BuildAll() error {
-	for _, spec := range p.Specs {
-		if err := p.applySpec(spec); err != nil {
+// resolve a path relative to the project root; absolute paths are cleaned and
+// returned as-is.  an empty path resolves to the project root itself.  unless
+// the project is unrestricted, paths that escape the root (including through
+// symlinks on the host) are rejected with ErrOutsideRoot.
+func (p *Project) ResolvePath(path string) (string, error) {
+	root, abs, rel, err := p.resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !p.UnrestrictedPaths {
+		host := func(link string) (string, bool) {
+			return hostRel(root, link)
+		}
+		if err := checkSymlinks(NewOSFS(root), rel, host); err != nil {
+			return "", fmt.Errorf("%w: %s", err, path)
+		}
+	}
+
+	return abs, nil
+}
+
+// resolve a path for a command run on the host.  commands can't be confined to
+// the project filesystem, so they are only run when it is the host filesystem
+// at the project root.
+func (p *Project) HostPath(path string) (string, error) {
+	if p.FS != nil {
+		osfs, ok := p.FS.(*OSFS)
+		if !ok || !sameFile(osfs.dir, p.Path) {
+			return "", fmt.Errorf("%w: project %s", ErrNotHostFS, p.Name)
+		}
+	}
+
+	return p.ResolvePath(path)
+}
+
+// resolve a path to the filesystem that serves it and the name within that
+// filesystem.  paths inside the project use the project filesystem; paths
+// outside it are only available to unrestricted projects on the host
+// filesystem.
+func (p *Project) ResolveFS(target string) (WritableFS, string, error) {
+	root, abs, rel, err := p.resolve(target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if filepath.IsLocal(rel) {
+		fsys, name := p.FS, filepath.ToSlash(rel)
+
+		// absolute links on the host are relative to the system root, while
+		// in other filesystems they are relative to the project root
+		abs := func(link string) (string, bool) {
+			return strings.TrimPrefix(path.Clean(filepath.ToSlash(link)), "/"), true
+		}
+
+		if fsys == nil {
+			fsys = NewOSFS(root)
+			abs = func(link string) (string, bool) {
+				return hostRel(root, link)
+			}
+		}
+
+		if !p.UnrestrictedPaths {
+			if err := checkSymlinks(fsys, name, abs); err != nil {
+				return nil, "", fmt.Errorf("%w: %s", err, target)
+			}
+		}
+
+		return fsys, name, nil
+	}
+
+	if p.FS != nil {
+		return nil, "", fmt.Errorf("path %s is outside the project filesystem", target)
+	}
+
+	// the host filesystem is rooted at the volume containing the path
+	volume := filepath.VolumeName(abs)
+	name := strings.TrimPrefix(filepath.ToSlash(abs[len(volume):]), "/")
+	if name == "" {
+		name = "."
+	}
+
+	return NewOSFS(volume + string(filepath.Separator)), name, nil
+}
+
+// lexically resolve a path against the project root, returning the root, the
+// absolute path and the path relative to the root
+func (p *Project) resolve(target string) (string, string, string, error) {
+	root, err := filepath.Abs(p.Path)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	abs := target
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(root, abs)
+	}
+
+	abs, err = filepath.Abs(abs)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if !filepath.IsLocal(rel) && !p.UnrestrictedPaths {
+		return "", "", "", fmt.Errorf("%w: %s", ErrOutsideRoot, target)
+	}
+
+	return root, abs, rel, nil
+}
+
+func (p *Project) BuildAll(opts ...RunOption) error {
+	run := p.newRun(opts, true)
+	run.projectStart(p)
+
+	specs, err := p.runSpecs(run)
+	if err != nil {
+		run.projectEnd(p, err)
+		return err
+	}
+
+	for idx, spec := range specs {
+		if err := p.applySpec(spec, run); err != nil {
+			run.skip(p, specs[idx+1:])
+
+			if run.transaction {
+				if rbErr := run.rollback(p); rbErr != nil {
+					err = errors.Join(err, rbErr)
+				}
+			}
+
+			run.projectEnd(p, err)
 			return err
 		}
 	}
+
+	run.projectEnd(p, nil)
 	return nil
 }
 
-func (p *Project) applySpec(spec Specification) error {
-	check, err := spec.Check(p)
+// check every spec without applying, returning the specs that are out of date
+func (p *Project) Plan(opts ...RunOption) ([]Specification, error) {
+	run := p.newRun(opts, false)
+	run.projectStart(p)
+
+	specs, err := p.runSpecs(run)
+	if err != nil {
+		run.projectEnd(p, err)
+		return nil, err
+	}
+
+	drift := []Specification{}
+	for idx, spec := range specs {
+		started := time.Now()
+		run.specCheck(p, spec)
+
+		var check bool
+		retries, err := retryCall(p, spec, p.retryPolicy(spec), func() (err error) {
+			check, err = spec.Check(p)
+			return err
+		})
+		if err != nil {
+			run.specResult(p, SpecResult{Spec: spec, Outcome: OutcomeFailed, Duration: time.Since(started), Err: err, Retries: retries})
+			run.skip(p, specs[idx+1:])
+			run.projectEnd(p, err)
+			return drift, err
+		}
+
+		if check {
+			run.specResult(p, SpecResult{Spec: spec, Outcome: OutcomeUpToDate, Duration: time.Since(started), Retries: retries})
+			continue
+		}
+
+		drift = append(drift, spec)
+		run.specResult(p, SpecResult{
+			Spec:     spec,
+			Outcome:  OutcomeDrift,
+			Duration: time.Since(started),
+			Diff:     diffSpec(p, spec),
+			Retries:  retries,
+		})
+	}
+
+	run.projectEnd(p, nil)
+	return drift, nil
+}
+
+func (p *Project) applySpec(spec Specification, run *runConfig) error {
+	started := time.Now()
+	run.specCheck(p, spec)
+
+	policy := p.retryPolicy(spec)
+	var check bool
+	retries, err := retryCall(p, spec, policy, func() (err error) {
+		check, err = spec.Check(p)
+		return err
+	})
 	if err != nil {
-		log.Warn().Str("project", p.Name).Type("spec", spec).Msg("Failed to check")
+		run.specResult(p, SpecResult{Spec: spec, Outcome: OutcomeFailed, Duration: time.Since(started), Err: err, Retries: retries})
 		return err
 	}
 
 	if check {
-		log.Info().Str("project", p.Name).Type("spec", spec).Msg("Skipping; up to date")
+		run.specResult(p, SpecResult{Spec: spec, Outcome: OutcomeUpToDate, Duration: time.Since(started), Retries: retries})
 		return nil
 	}
 
-	log.Info().Str("project", p.Name).Type("spec", spec).Msg("Applying")
-	if err := spec.Apply(p); err != nil {
-		log.Warn().Str("project", p.Name).Type("spec", spec).Msg("Failed to apply")
-		return err
+	result := SpecResult{Spec: spec, Outcome: OutcomeApplied, Applied: true, Diff: diffSpec(p, spec), Retries: retries}
+
+	var snapshot Snapshot
+	if run.transaction {
+		if snapshot, err = snapshotSpec(p, spec); err != nil {
+			err = fmt.Errorf("snapshot failed: %w", err)
+			run.specResult(p, SpecResult{Spec: spec, Outcome: OutcomeFailed, Duration: time.Since(started), Err: err, Retries: retries})
+			return err
+		}
 	}
 
-	return nil
+	run.specApply(p, spec)
+	retries, err = retryCall(p, spec, policy, func() error {
+		return spec.Apply(p)
+	})
+	result.Retries += retries
+
+	if err != nil {
+		result.Outcome = OutcomeFailed
+		result.Err = err
+
+		// undo whatever the failed spec changed before it stopped
+		if snapshot != nil {
+			if rbErr := snapshot.Restore(p); rbErr != nil {
+				log.Warn().Err(rbErr).Str("project", p.Name).Type("spec", spec).Msg("Unable to roll back failed spec")
+			}
+		}
+	} else if run.transaction {
+		run.applied = append(run.applied, appliedSpec{spec: spec, snapshot: snapshot})
+	}
+
+	result.Duration = time.Since(started)
+	run.specResult(p, result)
+
+	return result.Err
 }
 
-func RegisterProject(project *Project) {
-	log.Trace().Str("project", project.Name).Msg("Registering project")
-	projectsConfig = append(projectsConfig, *project)
+func newProjectRegistry() *ProjectRegistry {
+	return &ProjectRegistry{names: []string{}, projects: map[string]*projectEntry{}}
+}
+
+// add a project to the default registry; see ProjectRegistry.Register
+func RegisterProject(project *Project) error {
+	return defaultRegistry.Projects.register(project, callerLocation(1))
 }
 
+// return projects from the default registry; see ProjectRegistry.Filter
 func FilterProjects(names []string) []*Project {
+	return defaultRegistry.Projects.Filter(names)
+}
+
+// return projects from the default registry; see ProjectRegistry.Select
+func SelectProjects(selector *Selector) []*Project {
+	return defaultRegistry.Projects.Select(selector)
+}
+
+// set how projects registered under an existing name are handled
+func (r *ProjectRegistry) SetDuplicatePolicy(policy DuplicatePolicy) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.policy = policy
+}
+
+// add a project; a project with the same name is handled by the registry's
+// duplicate policy, and keeps its position when replaced
+func (r *ProjectRegistry) Register(project *Project) error {
+	return r.register(project, callerLocation(1))
+}
+
+func (r *ProjectRegistry) register(project *Project, location string) error {
+	log.Trace().Str("project", project.Name).Msg("Registering project")
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if existing, ok := r.projects[project.Name]; ok {
+		duplicate := &DuplicateNameError{Type: "project", Name: project.Name, Location: location, Existing: existing.location}
+		if err := r.policy.resolve(duplicate); err != nil {
+			return err
+		}
+	} else {
+		r.names = append(r.names, project.Name)
+	}
+
+	r.projects[project.Name] = &projectEntry{project: project, location: location}
+	return nil
+}
+
+// remove a project; returns false if it was not registered
+func (r *ProjectRegistry) Unregister(name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.projects[name]; !ok {
+		return false
+	}
+
+	delete(r.projects, name)
+	r.names = slices.DeleteFunc(r.names, func(n string) bool { return n == name })
+	return true
+}
+
+func (r *ProjectRegistry) Get(name string) (*Project, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.projects[name]
+	if !ok {
+		return nil, false
+	}
+	return entry.project, true
+}
+
+func (r *ProjectRegistry) Has(name string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.projects[name]
+	return ok
+}
+
+// return the names of all registered projects, in registration order
+func (r *ProjectRegistry) List() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return slices.Clone(r.names)
+}
+
+// return the projects with the given names, or all projects if no names are
+// given, in registration order
+func (r *ProjectRegistry) Filter(names []string) []*Project {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	projects := []*Project{}
+	for _, name := range r.names {
+		if slices.Contains(names, name) || len(names) == 0 {
+			projects = append(projects, r.projects[name].project)
+		}
+	}
+	return projects
+}
+
+// return the projects matching the selector, or all projects if the selector
+// is nil, in registration order
+func (r *ProjectRegistry) Select(selector *Selector) []*Project {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
 	projects := []*Project{}
-	for _, project := range projectsConfig {
-		if slices.Contains(names, project.Name) || len(names) == 0 {
-			projects = append(projects, &project)
+	for _, name := range r.names {
+		if project := r.projects[name].project; selector.Matches(project) {
+			projects = append(projects, project)
 		}
 	}
 	return projects
@@ -1,6 +1,7 @@
 package spec
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -137,6 +138,103 @@ func TestBuildAll(t *testing.T) {
 	})
 }
 
+func TestResolvePath(t *testing.T) {
+	project := NewProject("test").WithPath("/path/to/proj").Build()
+
+	testCases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "empty", path: "", want: "/path/to/proj"},
+		{name: "relative", path: "sub/file.txt", want: "/path/to/proj/sub/file.txt"},
+		{name: "absolute inside", path: "/path/to/proj/sub", want: "/path/to/proj/sub"},
+		{name: "unclean", path: "./sub/../file.txt", want: "/path/to/proj/file.txt"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := project.ResolvePath(tt.path)
+			if err != nil {
+				t.Fatalf("ResolvePath failed: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("outside root", func(t *testing.T) {
+		if _, err := project.ResolvePath("/etc/hosts"); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("expected ErrOutsideRoot, got %v", err)
+		}
+
+		unrestricted := NewProject("test").WithPath("/path/to/proj").WithUnrestrictedPaths().Build()
+		got, err := unrestricted.ResolvePath("/etc/hosts")
+		if err != nil {
+			t.Fatalf("ResolvePath failed: %v", err)
+		}
+
+		if got != "/etc/hosts" {
+			t.Fatalf("expected /etc/hosts, got %s", got)
+		}
+	})
+}
+
+func TestResolveFS(t *testing.T) {
+	t.Run("project filesystem", func(t *testing.T) {
+		mem := NewMemFS()
+		project := NewProject("test").WithPath("/proj").WithFS(mem).Build()
+
+		fsys, name, err := project.ResolveFS("sub/file.txt")
+		if err != nil {
+			t.Fatalf("ResolveFS failed: %v", err)
+		}
+
+		if fsys != mem {
+			t.Fatal("expected project filesystem")
+		}
+
+		if name != "sub/file.txt" {
+			t.Fatalf("expected name sub/file.txt, got %s", name)
+		}
+
+		_, name, err = project.ResolveFS("/proj")
+		if err != nil {
+			t.Fatalf("ResolveFS failed: %v", err)
+		}
+
+		if name != "." {
+			t.Fatalf("expected name ., got %s", name)
+		}
+	})
+
+	t.Run("outside custom filesystem", func(t *testing.T) {
+		project := NewProject("test").WithPath("/proj").WithFS(NewMemFS()).Build()
+
+		if _, _, err := project.ResolveFS("../other"); err == nil {
+			t.Fatal("expected error for path outside project filesystem")
+		}
+	})
+
+	t.Run("outside host filesystem", func(t *testing.T) {
+		project := NewProject("test").WithPath("/proj").WithUnrestrictedPaths().Build()
+
+		fsys, name, err := project.ResolveFS("/etc/hosts")
+		if err != nil {
+			t.Fatalf("ResolveFS failed: %v", err)
+		}
+
+		if _, ok := fsys.(*OSFS); !ok {
+			t.Fatalf("expected OSFS, got %T", fsys)
+		}
+
+		if name != "etc/hosts" {
+			t.Fatalf("expected name etc/hosts, got %s", name)
+		}
+	})
+}
+
 // Test helpers
 
 type TestCheckErrorSpec struct{}
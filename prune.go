@@ -0,0 +1,134 @@
+package spec
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+// PruneSpec removes a resource created by a spec that was previously applied
+// to the project but is no longer declared.
+type PruneSpec struct {
+	// ID of the spec in the project state
+	ID string
+
+	// the spec as recorded in the state, and as recreated from it
+	State *SpecState
+	Spec  Specification
+}
+
+// remove resources of previously applied specs that are no longer declared;
+// the project must have a StateStore.  orphans are pruned before declared
+// specs are applied, and are included in the results of Plan.
+func WithPrune() RunOption {
+	return func(cfg *runConfig) {
+		cfg.prune = true
+	}
+}
+
+func (s *PruneSpec) Check(project *Project) (bool, error) {
+	return (&RemoveSpec{Spec: s.Spec}).Check(project)
+}
+
+func (s *PruneSpec) Apply(project *Project) error {
+	return (&RemoveSpec{Spec: s.Spec}).Apply(project)
+}
+
+func (s *PruneSpec) Snapshot(project *Project) (Snapshot, error) {
+	return snapshotSpec(project, s.Spec)
+}
+
+func (s *PruneSpec) String() string {
+	return "prune " + Describe(s.Spec)
+}
+
+// find specs recorded in the project state that are no longer declared.
+// orphans that cannot be recreated or do not support removal are logged and
+// left in the state.
+func (p *Project) Orphans() ([]*PruneSpec, error) {
+	return p.orphans(p.State)
+}
+
+// find orphans in the state recorded in the store
+func (p *Project) orphans(store StateStore) ([]*PruneSpec, error) {
+	if store == nil {
+		return nil, fmt.Errorf("project %s has no state store", p.Name)
+	}
+
+	state, err := store.Load(p)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := p.registry()
+
+	declared := map[string]bool{}
+	for _, spec := range p.Specs {
+		if id, _, ok := registry.Specs.ID(spec); ok {
+			declared[id] = true
+		}
+	}
+
+	orphans := []*PruneSpec{}
+	for _, id := range slices.Sorted(maps.Keys(state.Specs)) {
+		recorded := state.Specs[id]
+		if declared[id] || recorded.Mode == ModeRemove {
+			continue
+		}
+
+		// entries recorded under an older ID are superseded by a declared spec
+		// that manages the same resource
+		if spec, err := recorded.SpecIn(registry); err == nil {
+			if current, _, ok := registry.Specs.ID(spec); ok && declared[current] {
+				continue
+			}
+		}
+
+		// recreate the spec without its mode, which only applies when declared
+		spec, err := (&SpecState{Kind: recorded.Kind, Unrestricted: recorded.Unrestricted, Config: recorded.Config}).SpecIn(registry)
+		if err != nil {
+			log.Warn().Err(err).Str("project", p.Name).Str("spec", recorded.Kind).Msg("Unable to recreate orphaned spec")
+			continue
+		}
+
+		inner := spec
+		if u, ok := spec.(*UnrestrictedSpec); ok {
+			inner = u.Spec
+		}
+
+		if _, ok := inner.(RemovableSpec); !ok {
+			log.Warn().Str("project", p.Name).Str("spec", recorded.Kind).Msg("Orphaned spec does not support removal")
+			continue
+		}
+
+		orphans = append(orphans, &PruneSpec{ID: id, State: recorded, Spec: spec})
+	}
+
+	return orphans, nil
+}
+
+// the specs for a run, preceded by orphans when pruning and selected by tags
+func (p *Project) runSpecs(run *runConfig) ([]Specification, error) {
+	specs := p.Specs
+
+	if run.prune {
+		orphans, err := p.orphans(run.state)
+		if err != nil {
+			return nil, err
+		}
+
+		specs = make([]Specification, 0, len(orphans)+len(p.Specs))
+		for _, orphan := range orphans {
+			specs = append(specs, orphan)
+		}
+		specs = append(specs, p.Specs...)
+	}
+
+	if run.tags != nil {
+		specs = run.tags.filter(specs)
+	}
+
+	return specs, nil
+}
@@ -0,0 +1,228 @@
+package spec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	fsys := NewMemFS()
+	store := NewFileStateStore("")
+	kept := &EnvFileSpec{Path: ".env", Key: "A", Value: "1"}
+	dropped := &EnvFileSpec{Path: ".env", Key: "B", Value: "2"}
+
+	project := NewProject("prune").
+		WithFS(fsys).
+		WithStateStore(store).
+		WithSpec(kept).
+		WithSpec(dropped).
+		Build()
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	// the spec is no longer declared, but its key remains
+	project.Specs = []Specification{kept}
+
+	t.Run("orphans", func(t *testing.T) {
+		orphans, err := project.Orphans()
+		if err != nil {
+			t.Fatalf("Orphans failed: %v", err)
+		}
+
+		if len(orphans) != 1 {
+			t.Fatalf("expected 1 orphan, got %d", len(orphans))
+		}
+
+		env, ok := orphans[0].Spec.(*EnvFileSpec)
+		if !ok || env.Key != "B" {
+			t.Fatalf("unexpected orphan %+v", orphans[0].Spec)
+		}
+	})
+
+	t.Run("plan preview", func(t *testing.T) {
+		events := &TestObserver{}
+		drift, err := project.Plan(WithPrune(), WithObserver(events))
+		if err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+
+		if len(drift) != 1 || Describe(drift[0]) != "prune envfile .env:B" {
+			t.Fatalf("expected prune drift, got %v", events.events)
+		}
+
+		data, _ := fsys.ReadFile(".env")
+		if !strings.Contains(string(data), "B=2") {
+			t.Fatal("expected Plan to leave the resource in place")
+		}
+	})
+
+	t.Run("not without option", func(t *testing.T) {
+		drift, err := project.Plan()
+		if err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+
+		if len(drift) != 0 {
+			t.Fatalf("expected no drift, got %d", len(drift))
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		events := &TestObserver{}
+		if err := project.BuildAll(WithPrune(), WithObserver(events)); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		expected := []string{
+			"start prune",
+			"check prune envfile .env:B",
+			"apply prune envfile .env:B",
+			"result prune envfile .env:B applied",
+			"check envfile .env:A",
+			"result envfile .env:A ok",
+			"end prune <nil>",
+		}
+
+		if !reflect.DeepEqual(events.events, expected) {
+			t.Fatalf("unexpected events:\n%v\nexpected:\n%v", events.events, expected)
+		}
+
+		data, _ := fsys.ReadFile(".env")
+		if strings.Contains(string(data), "B=") || !strings.Contains(string(data), "A=1") {
+			t.Fatalf("unexpected env file:\n%s", data)
+		}
+
+		state, err := store.Load(project)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+
+		if len(state.Specs) != 1 {
+			t.Fatalf("expected pruned spec to be dropped from state, got %d specs", len(state.Specs))
+		}
+
+		orphans, _ := project.Orphans()
+		if len(orphans) != 0 {
+			t.Fatalf("expected no orphans, got %d", len(orphans))
+		}
+	})
+
+	t.Run("no state store", func(t *testing.T) {
+		project := NewProject("stateless").WithSpec(&TestSpec{}).Build()
+
+		if err := project.BuildAll(WithPrune()); err == nil {
+			t.Fatal("expected error when pruning without a state store")
+		}
+
+		if _, err := project.Plan(WithPrune()); err == nil {
+			t.Fatal("expected error when planning a prune without a state store")
+		}
+	})
+}
+
+func TestPruneUnrestricted(t *testing.T) {
+	fsys := NewMemFS()
+	store := NewFileStateStore("")
+
+	state := NewState(&Project{Name: "unrestricted"})
+	state.Specs["orphan"] = &SpecState{
+		Kind:         "envfile",
+		Mode:         ModeEnsure,
+		Unrestricted: true,
+		Config:       map[string]any{"path": ".env", "key": "A", "value": "1"},
+	}
+
+	project := NewProject("unrestricted").WithFS(fsys).WithStateStore(store).Build()
+	if err := store.Save(project, state); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.WriteFile(".env", []byte("A=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := project.Orphans()
+	if err != nil {
+		t.Fatalf("Orphans failed: %v", err)
+	}
+
+	if len(orphans) != 1 {
+		t.Fatalf("expected 1 orphan, got %d", len(orphans))
+	}
+
+	if _, ok := orphans[0].Spec.(*UnrestrictedSpec); !ok {
+		t.Fatalf("expected unrestricted orphan, got %T", orphans[0].Spec)
+	}
+
+	if err := project.BuildAll(WithPrune()); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	data, _ := fsys.ReadFile(".env")
+	if strings.Contains(string(data), "A=") {
+		t.Fatalf("expected key to be removed:\n%s", data)
+	}
+}
+
+func TestPruneEditedSpec(t *testing.T) {
+	fsys := NewMemFS()
+	store := NewFileStateStore("")
+	if err := fsys.WriteFile(".env", []byte("A=1\nB=2\nC=3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	project := NewProject("edited").
+		WithFS(fsys).
+		WithStateStore(store).
+		WithSpec(&EnvFileSpec{Path: ".env", Key: "A", Value: "10"}).
+		Build()
+
+	if err := project.BuildAll(WithPrune()); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	// only the value changes, so the key is updated in place
+	project.Specs = []Specification{&EnvFileSpec{Path: ".env", Key: "A", Value: "20"}}
+
+	if orphans, err := project.Orphans(); err != nil || len(orphans) != 0 {
+		t.Fatalf("expected no orphans, got %d (%v)", len(orphans), err)
+	}
+
+	if err := project.BuildAll(WithPrune()); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	data, _ := fsys.ReadFile(".env")
+	if string(data) != "A=20\nB=2\nC=3\n" {
+		t.Fatalf("expected the key to keep its place, got %q", data)
+	}
+
+	state, err := store.Load(project)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(state.Specs) != 1 {
+		t.Fatalf("expected 1 recorded spec, got %d", len(state.Specs))
+	}
+
+	for _, recorded := range state.Specs {
+		if recorded.Config["value"] != "20" {
+			t.Fatalf("expected the edited config to be recorded, got %v", recorded.Config)
+		}
+	}
+
+	t.Run("recorded under an older ID", func(t *testing.T) {
+		state.Specs["older"] = &SpecState{Kind: "envfile", Config: map[string]any{"path": ".env", "key": "A", "value": "10"}}
+		if err := store.Save(project, state); err != nil {
+			t.Fatal(err)
+		}
+
+		if orphans, err := project.Orphans(); err != nil || len(orphans) != 0 {
+			t.Fatalf("expected the older entry to be superseded, got %d orphans (%v)", len(orphans), err)
+		}
+	})
+}
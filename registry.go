@@ -0,0 +1,235 @@
+package spec
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Registry holds the spec kinds, blueprints and projects available to config
+// files and runs.  the package-level Register functions use the default
+// registry; create separate registries to keep independent sets apart.
+type Registry struct {
+	Specs      *SpecRegistry
+	Blueprints *BlueprintRegistry
+	Projects   *ProjectRegistry
+}
+
+// DuplicatePolicy controls what happens when a name is registered twice.
+type DuplicatePolicy int
+
+const (
+	// replace the existing entry and log a warning (the default)
+	DuplicateWarn DuplicatePolicy = iota
+
+	// keep the existing entry and return a DuplicateNameError
+	DuplicateError
+
+	// replace the existing entry silently
+	DuplicateOverride
+)
+
+// DuplicateNameError reports a name that is already registered.
+type DuplicateNameError struct {
+	// what was registered: spec, blueprint or project
+	Type string
+	Name string
+
+	// where the name was registered again, and where it was first registered;
+	// a file and line for registrations in code, or the config file path
+	Location string
+	Existing string
+}
+
+var defaultRegistry = newRegistry()
+
+// create a registry containing the built-in spec kinds
+func NewRegistry() *Registry {
+	r := newRegistry()
+	registerBuiltins(r.Specs)
+	return r
+}
+
+// the registry used by the package-level functions
+func Default() *Registry {
+	return defaultRegistry
+}
+
+func newRegistry() *Registry {
+	return &Registry{
+		Specs:      newSpecRegistry(),
+		Blueprints: newBlueprintRegistry(),
+		Projects:   newProjectRegistry(),
+	}
+}
+
+// set the duplicate policy of the spec, blueprint and project registries
+func (r *Registry) SetDuplicatePolicy(policy DuplicatePolicy) {
+	r.Specs.SetDuplicatePolicy(policy)
+	r.Blueprints.SetDuplicatePolicy(policy)
+	r.Projects.SetDuplicatePolicy(policy)
+}
+
+// read a config file and add its blueprints and projects to the registry
+func (r *Registry) LoadConfig(path string) error {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	if err := r.registerConfig(config, callerPackage(1), path); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// build the blueprints and projects in the config and add them to the
+// registry; blueprints may refer to earlier blueprints or to any registered
+// blueprint
+func (r *Registry) RegisterConfig(config *Config) error {
+	return r.registerConfig(config, callerPackage(1), callerLocation(1))
+}
+
+// entries are registered at the config file path, or at the caller location
+// for configs that were not loaded from a file
+func (r *Registry) registerConfig(config *Config, pkg, location string) error {
+	if config.path != "" {
+		location = config.path
+	}
+
+	for _, bc := range config.Blueprints {
+		bp, err := r.BuildBlueprint(&bc)
+		if err != nil {
+			return err
+		}
+		if err := r.Blueprints.register(bp, pkg, location); err != nil {
+			return err
+		}
+	}
+
+	projects, err := r.BuildProjects(config)
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err := r.Projects.register(project, location); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// build the projects in the config without registering them; referenced
+// blueprints must already be registered
+func (r *Registry) BuildProjects(config *Config) ([]*Project, error) {
+	projects := []*Project{}
+	for _, pc := range config.Projects {
+		project, err := r.BuildProject(&pc, config.dir)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, nil
+}
+
+// return the registry of a project, or the default registry
+func (p *Project) registry() *Registry {
+	if p.Registry != nil {
+		return p.Registry
+	}
+	return defaultRegistry
+}
+
+// parse a policy name: error, warn or override
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch name {
+	case "warn":
+		return DuplicateWarn, nil
+	case "error":
+		return DuplicateError, nil
+	case "override":
+		return DuplicateOverride, nil
+	}
+	return DuplicateWarn, fmt.Errorf("unknown duplicate policy %q", name)
+}
+
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateWarn:
+		return "warn"
+	case DuplicateError:
+		return "error"
+	case DuplicateOverride:
+		return "override"
+	}
+	return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+}
+
+// return the error for a duplicate, or nil if the existing entry should be
+// replaced
+func (p DuplicatePolicy) resolve(err *DuplicateNameError) error {
+	switch p {
+	case DuplicateError:
+		return err
+	case DuplicateWarn:
+		log.Warn().Str(err.Type, err.Name).Str("location", err.Location).Str("existing", err.Existing).Msg("Replacing duplicate registration")
+	}
+	return nil
+}
+
+func (e *DuplicateNameError) Error() string {
+	return fmt.Sprintf("%s %s registered at %s is already registered at %s", e.Type, e.Name, e.Location, e.Existing)
+}
+
+// join a namespace and name, e.g. acme and file become acme/file
+func QualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// split a registered name into its namespace and local name; the namespace is
+// empty for names without one
+func SplitName(name string) (namespace, local string) {
+	if ns, local, ok := strings.Cut(name, "/"); ok {
+		return ns, local
+	}
+	return "", name
+}
+
+// check a spec or blueprint name; names may have a single namespace prefix,
+// e.g. acme/file, and may not contain spaces
+func validateName(typ, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s is missing a name", typ)
+	}
+
+	if strings.ContainsFunc(name, unicode.IsSpace) {
+		return fmt.Errorf("invalid %s name %q: names may not contain spaces", typ, name)
+	}
+
+	namespace, local := SplitName(name)
+	if strings.Contains(name, "/") && (namespace == "" || local == "" || strings.Contains(local, "/")) {
+		return fmt.Errorf("invalid %s name %q: expected namespace/name", typ, name)
+	}
+
+	return nil
+}
+
+// return the file and line of a calling function; skip is the number of
+// frames above the caller of callerLocation
+func callerLocation(skip int) string {
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
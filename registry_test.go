@@ -0,0 +1,325 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistryIsolation(t *testing.T) {
+	registry := NewRegistry()
+
+	if !slices.Equal(registry.Specs.List(), ListSpecs()) {
+		t.Fatal("expected new registries to contain the built-in specs")
+	}
+
+	RegisterSpecTypeIn[TestSpec](registry.Specs, "isolated-spec")
+	registry.Blueprints.Register(&Blueprint{Name: "isolated-blueprint"})
+	registry.Projects.Register(NewProject("isolated-project").Build())
+
+	if Specs().Has("isolated-spec") || Blueprints().Has("isolated-blueprint") || len(FilterProjects([]string{"isolated-project"})) != 0 {
+		t.Fatal("expected the default registry to be unchanged")
+	}
+
+	if _, ok := SpecKind(&TestSpec{}); ok {
+		t.Fatal("expected spec kind to be limited to its registry")
+	}
+
+	if kind, ok := registry.Specs.Kind(&TestSpec{}); !ok || kind != "isolated-spec" {
+		t.Fatalf("expected spec kind in the registry, got %q", kind)
+	}
+
+	if len(registry.Projects.Filter(nil)) != 1 {
+		t.Fatal("expected the project in the registry")
+	}
+}
+
+func TestRegistryConfig(t *testing.T) {
+	registry := NewRegistry()
+	RegisterSpecTypeIn[EnvFileSpec](registry.Specs, "registry-env")
+
+	config, err := ParseConfig([]byte(`
+blueprints:
+  - name: registry-base
+    specs:
+      - kind: registry-env
+        config: { path: .env, key: A, value: "1" }
+projects:
+  - name: registry-project
+    blueprints: [registry-base]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+
+	if err := registry.RegisterConfig(config); err != nil {
+		t.Fatalf("RegisterConfig failed: %v", err)
+	}
+
+	if Blueprints().Has("registry-base") || len(FilterProjects([]string{"registry-project"})) != 0 {
+		t.Fatal("expected config to be registered only in the given registry")
+	}
+
+	if err := config.Register(); err == nil {
+		t.Fatal("expected the default registry to be missing the spec kind")
+	}
+
+	projects := registry.Projects.Filter([]string{"registry-project"})
+	if len(projects) != 1 || projects[0].Registry != registry {
+		t.Fatal("expected the project to use the registry")
+	}
+
+	t.Run("state", func(t *testing.T) {
+		fsys := NewMemFS()
+		store := NewFileStateStore("")
+
+		project := projects[0]
+		project.FS = fsys
+		project.State = store
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		state, err := store.Load(project)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+
+		for _, recorded := range state.Specs {
+			if recorded.Kind != "registry-env" {
+				t.Fatalf("expected spec recorded with its registry kind, got %q", recorded.Kind)
+			}
+		}
+
+		if len(state.Specs) != 1 {
+			t.Fatalf("expected 1 recorded spec, got %d", len(state.Specs))
+		}
+
+		// orphans are recreated from the project registry
+		project.Specs = nil
+		orphans, err := project.Orphans()
+		if err != nil || len(orphans) != 1 {
+			t.Fatalf("expected 1 orphan, got %d (%v)", len(orphans), err)
+		}
+	})
+}
+
+func TestDuplicatePolicy(t *testing.T) {
+	factory := func(config any) (Specification, error) {
+		return &TestSpec{}, nil
+	}
+
+	t.Run("error", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.SetDuplicatePolicy(DuplicateError)
+
+		if err := registry.Specs.Register("dup-spec", factory, WithSpecDescription("first")); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+
+		err := registry.Specs.Register("dup-spec", factory, WithSpecDescription("second"))
+
+		var duplicate *DuplicateNameError
+		if !errors.As(err, &duplicate) {
+			t.Fatalf("expected DuplicateNameError, got %v", err)
+		}
+
+		// both registrations are in this file
+		if !strings.Contains(duplicate.Location, "registry_test.go:") || !strings.Contains(duplicate.Existing, "registry_test.go:") || duplicate.Location == duplicate.Existing {
+			t.Fatalf("expected both caller locations, got %v", err)
+		}
+
+		if info, _ := registry.Specs.Info("dup-spec"); info.Description != "first" {
+			t.Fatal("expected the first registration to be kept")
+		}
+
+		if err := RegisterSpecTypeIn[TestSpec](registry.Specs, "envfile"); err == nil || !strings.Contains(err.Error(), "already registered at built-in") {
+			t.Fatalf("expected duplicate of a built-in, got %v", err)
+		}
+
+		if _, ok := registry.Specs.Kind(&TestSpec{}); ok {
+			t.Fatal("expected the rejected spec type not to be registered")
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		registry := NewRegistry()
+
+		registry.Blueprints.Register(NewBlueprint("dup-blueprint").WithDescription("first").Build())
+		if err := registry.Blueprints.Register(NewBlueprint("dup-blueprint").WithDescription("second").Build()); err != nil {
+			t.Fatalf("expected warning only, got %v", err)
+		}
+
+		if bp, _ := registry.Blueprints.Get("dup-blueprint"); bp.Description != "second" {
+			t.Fatal("expected the blueprint to be replaced")
+		}
+	})
+
+	t.Run("override", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.SetDuplicatePolicy(DuplicateOverride)
+
+		registry.Projects.Register(NewProject("dup-project").WithDescription("first").Build())
+		registry.Projects.Register(NewProject("other-project").Build())
+		if err := registry.Projects.Register(NewProject("dup-project").WithDescription("second").Build()); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+
+		projects := registry.Projects.Filter(nil)
+		if len(projects) != 2 || projects[0].Name != "dup-project" || projects[0].Desc != "second" {
+			t.Fatal("expected the project to be replaced in place")
+		}
+	})
+
+	t.Run("config", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.SetDuplicatePolicy(DuplicateError)
+
+		registry.Projects.Register(NewProject("config-dup").Build())
+
+		config, err := ParseConfig([]byte(`
+projects:
+  - name: config-dup
+`))
+		if err != nil {
+			t.Fatalf("ParseConfig failed: %v", err)
+		}
+
+		var duplicate *DuplicateNameError
+		if err := registry.RegisterConfig(config); !errors.As(err, &duplicate) || duplicate.Type != "project" {
+			t.Fatalf("expected duplicate project, got %v", err)
+		}
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		for _, policy := range []DuplicatePolicy{DuplicateWarn, DuplicateError, DuplicateOverride} {
+			if parsed, err := ParseDuplicatePolicy(policy.String()); err != nil || parsed != policy {
+				t.Fatalf("expected %s, got %s (%v)", policy, parsed, err)
+			}
+		}
+
+		if _, err := ParseDuplicatePolicy("ignore"); err == nil {
+			t.Fatal("expected error for unknown policy")
+		}
+	})
+}
+
+func TestProjectRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	first := NewProject("store-first").Build()
+	second := NewProject("store-second").Build()
+	registry.Projects.Register(first)
+	registry.Projects.Register(second)
+
+	// later changes to the registered project are visible through the registry
+	first.Desc = "changed"
+
+	project, ok := registry.Projects.Get("store-first")
+	if !ok || project != first || project.Desc != "changed" {
+		t.Fatal("expected Get to return the registered project")
+	}
+
+	if projects := registry.Projects.Filter(nil); len(projects) != 2 || projects[0] != first || projects[1] != second {
+		t.Fatal("expected Filter to return the registered projects")
+	}
+
+	if projects := registry.Projects.Select(nil); len(projects) != 2 || projects[1] != second {
+		t.Fatal("expected Select to return the registered projects")
+	}
+
+	if _, ok := registry.Projects.Get("store-missing"); ok || registry.Projects.Has("store-missing") {
+		t.Fatal("expected missing project to be reported")
+	}
+
+	t.Run("unregister", func(t *testing.T) {
+		if !registry.Projects.Unregister("store-first") || registry.Projects.Unregister("store-first") {
+			t.Fatal("expected Unregister to report whether the project was registered")
+		}
+
+		registry.Projects.Register(first)
+
+		if names := registry.Projects.List(); !slices.Equal(names, []string{"store-second", "store-first"}) {
+			t.Fatalf("expected a project registered again to move to the end, got %v", names)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.SetDuplicatePolicy(DuplicateOverride)
+
+		var wg sync.WaitGroup
+		for worker := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for idx := range 50 {
+					name := fmt.Sprintf("concurrent-%d", idx%25)
+					registry.Projects.Register(NewProject(name).WithLabel("worker", fmt.Sprint(worker)).Build())
+					registry.Projects.Filter([]string{name})
+					registry.Projects.Select(nil)
+
+					if idx%10 == 0 {
+						registry.Projects.Unregister(name)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		names := registry.Projects.List()
+		if len(registry.Projects.Filter(nil)) != len(names) {
+			t.Fatal("expected names and projects to agree")
+		}
+
+		for _, name := range names {
+			if project, ok := registry.Projects.Get(name); !ok || project.Name != name {
+				t.Fatalf("expected project %s in the registry", name)
+			}
+		}
+
+		if len(names) < 20 || len(names) > 25 {
+			t.Fatalf("expected each name at most once, got %d names", len(names))
+		}
+	})
+}
+
+func TestNamespacedNames(t *testing.T) {
+	registry := NewRegistry()
+
+	if err := RegisterSpecTypeIn[TestSpec](registry.Specs, "acme/file"); err != nil {
+		t.Fatalf("RegisterSpecTypeIn failed: %v", err)
+	}
+
+	info, ok := registry.Specs.Info("acme/file")
+	if !ok || info.Namespace != "acme" {
+		t.Fatalf("expected namespaced spec, got %+v", info)
+	}
+
+	if registry.Specs.Has("file") {
+		t.Fatal("expected the local name not to be registered")
+	}
+
+	if name := QualifiedName("acme", "base"); name != "acme/base" {
+		t.Fatalf("unexpected qualified name %q", name)
+	}
+
+	if namespace, local := SplitName("envfile"); namespace != "" || local != "envfile" {
+		t.Fatalf("unexpected split %q %q", namespace, local)
+	}
+
+	for _, name := range []string{"", "/file", "acme/", "acme/tools/file", "my file"} {
+		if err := registry.Specs.Register(name, nil); err == nil {
+			t.Fatalf("expected error for spec name %q", name)
+		}
+
+		if err := registry.Blueprints.Register(&Blueprint{Name: name}); err == nil {
+			t.Fatalf("expected error for blueprint name %q", name)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package spec
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of running a single spec.
+type Outcome string
+
+const (
+	OutcomeUpToDate Outcome = "ok"
+	OutcomeApplied  Outcome = "applied"
+	OutcomeDrift    Outcome = "drift"
+	OutcomeFailed   Outcome = "failed"
+	OutcomeSkipped  Outcome = "skipped"
+
+	// applied, then restored when a later spec in a transaction failed
+	OutcomeRolledBack Outcome = "rolled back"
+)
+
+// optional interface for specs that can describe the changes Apply would make
+type DiffableSpec interface {
+	Diff(project *Project) (string, error)
+}
+
+// Report records the outcome of running specs across projects.  it is an
+// Observer, and may be shared by projects running concurrently.
+type Report struct {
+	Projects []*ProjectReport `json:"projects"`
+
+	lock    sync.Mutex
+	running map[*Project]*ProjectReport
+}
+
+// ProjectReport records the outcome of each spec in a project.
+type ProjectReport struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+	Specs    []*SpecReport `json:"specs"`
+}
+
+// SpecReport records the outcome of a single spec.
+type SpecReport struct {
+	Spec     string        `json:"spec"`
+	Outcome  Outcome       `json:"outcome"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+	Diff     string        `json:"diff,omitempty"`
+	Retries  int           `json:"retries,omitempty"`
+}
+
+func NewReport() *Report {
+	return &Report{Projects: []*ProjectReport{}}
+}
+
+func (r *Report) OnProjectStart(project *Project) {
+	report := &ProjectReport{
+		Name:    project.Name,
+		Path:    project.Path,
+		Started: time.Now(),
+		Specs:   []*SpecReport{},
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.running == nil {
+		r.running = make(map[*Project]*ProjectReport)
+	}
+
+	r.Projects = append(r.Projects, report)
+	r.running[project] = report
+}
+
+func (r *Report) OnSpecCheck(project *Project, spec Specification) {}
+
+func (r *Report) OnSpecApply(project *Project, spec Specification) {}
+
+func (r *Report) OnSpecResult(project *Project, result SpecResult) {
+	report := &SpecReport{
+		Spec:     Describe(result.Spec),
+		Outcome:  result.Outcome,
+		Duration: result.Duration,
+		Diff:     result.Diff,
+		Retries:  result.Retries,
+	}
+
+	if result.Err != nil {
+		report.Error = result.Err.Error()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if project := r.running[project]; project != nil {
+		project.Specs = append(project.Specs, report)
+	}
+}
+
+// mark the most recent applied spec as rolled back; rollbacks are made in
+// reverse order, so this is the spec being restored
+func (r *Report) OnSpecRollback(project *Project, spec Specification, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report := r.running[project]
+	if report == nil {
+		return
+	}
+
+	for _, applied := range slices.Backward(report.Specs) {
+		if applied.Outcome != OutcomeApplied || applied.Error != "" || applied.Spec != Describe(spec) {
+			continue
+		}
+
+		if err != nil {
+			applied.Error = "rollback failed: " + err.Error()
+		} else {
+			applied.Outcome = OutcomeRolledBack
+		}
+
+		return
+	}
+}
+
+func (r *Report) OnProjectEnd(project *Project, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report := r.running[project]
+	if report == nil {
+		return
+	}
+
+	report.Duration = time.Since(report.Started)
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	delete(r.running, project)
+}
+
+// count the specs with the given outcome across all projects
+func (r *Report) Count(outcome Outcome) int {
+	count := 0
+	for _, project := range r.Projects {
+		count += project.Count(outcome)
+	}
+	return count
+}
+
+// true if any project or spec failed
+func (r *Report) Failed() bool {
+	for _, project := range r.Projects {
+		if project.Error != "" || project.Count(OutcomeFailed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ProjectReport) Count(outcome Outcome) int {
+	count := 0
+	for _, spec := range p.Specs {
+		if spec.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// write the report as JUnit XML; each project is a test suite and each spec a
+// test case.  drift is reported as a failure so CI systems flag it.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	type message struct {
+		Message string `xml:"message,attr,omitempty"`
+		Body    string `xml:",chardata"`
+	}
+
+	type testCase struct {
+		Name      string   `xml:"name,attr"`
+		ClassName string   `xml:"classname,attr"`
+		Time      string   `xml:"time,attr"`
+		Failure   *message `xml:"failure,omitempty"`
+		Error     *message `xml:"error,omitempty"`
+		Skipped   *message `xml:"skipped,omitempty"`
+		SystemOut string   `xml:"system-out,omitempty"`
+	}
+
+	type testSuite struct {
+		Name      string     `xml:"name,attr"`
+		Tests     int        `xml:"tests,attr"`
+		Failures  int        `xml:"failures,attr"`
+		Errors    int        `xml:"errors,attr"`
+		Skipped   int        `xml:"skipped,attr"`
+		Time      string     `xml:"time,attr"`
+		Timestamp string     `xml:"timestamp,attr"`
+		Cases     []testCase `xml:"testcase"`
+	}
+
+	type testSuites struct {
+		XMLName xml.Name    `xml:"testsuites"`
+		Suites  []testSuite `xml:"testsuite"`
+	}
+
+	suites := testSuites{}
+	for _, project := range r.Projects {
+		suite := testSuite{
+			Name:      project.Name,
+			Tests:     len(project.Specs),
+			Failures:  project.Count(OutcomeDrift),
+			Errors:    project.Count(OutcomeFailed),
+			Skipped:   project.Count(OutcomeSkipped) + project.Count(OutcomeRolledBack),
+			Time:      seconds(project.Duration),
+			Timestamp: project.Started.UTC().Format(time.RFC3339),
+		}
+
+		for _, spec := range project.Specs {
+			tc := testCase{Name: spec.Spec, ClassName: project.Name, Time: seconds(spec.Duration)}
+			if spec.Retries > 0 {
+				tc.SystemOut = fmt.Sprintf("retried %d times", spec.Retries)
+			}
+
+			switch spec.Outcome {
+			case OutcomeDrift:
+				tc.Failure = &message{Message: "out of date", Body: spec.Diff}
+			case OutcomeFailed:
+				tc.Error = &message{Message: spec.Error}
+			case OutcomeSkipped:
+				tc.Skipped = &message{}
+			case OutcomeRolledBack:
+				tc.Skipped = &message{Message: "rolled back"}
+			}
+
+			suite.Cases = append(suite.Cases, tc)
+		}
+
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// write the report as a Markdown summary, suitable for a pull request comment
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var md strings.Builder
+
+	md.WriteString("# Spec Report\n\n")
+	fmt.Fprintf(&md, "%d projects: %d up to date, %d applied, %d drifted, %d failed, %d skipped\n",
+		len(r.Projects), r.Count(OutcomeUpToDate), r.Count(OutcomeApplied),
+		r.Count(OutcomeDrift), r.Count(OutcomeFailed), r.Count(OutcomeSkipped))
+
+	if rolledBack := r.Count(OutcomeRolledBack); rolledBack > 0 {
+		fmt.Fprintf(&md, "\n%d specs rolled back\n", rolledBack)
+	}
+
+	for _, project := range r.Projects {
+		fmt.Fprintf(&md, "\n## %s\n\n", project.Name)
+
+		if project.Error != "" {
+			fmt.Fprintf(&md, "**Error:** %s\n\n", markdownEscape(project.Error))
+		}
+
+		md.WriteString("| Spec | Outcome | Duration |\n")
+		md.WriteString("| --- | --- | --- |\n")
+
+		for _, spec := range project.Specs {
+			outcome := string(spec.Outcome)
+			if spec.Retries > 0 {
+				outcome += fmt.Sprintf(" (%d retries)", spec.Retries)
+			}
+
+			fmt.Fprintf(&md, "| `%s` | %s | %s |\n", spec.Spec, outcome, spec.Duration.Round(time.Millisecond))
+		}
+
+		for _, spec := range project.Specs {
+			if spec.Diff == "" && spec.Error == "" {
+				continue
+			}
+
+			fmt.Fprintf(&md, "\n<details><summary><code>%s</code></summary>\n\n", spec.Spec)
+			if spec.Error != "" {
+				fmt.Fprintf(&md, "**Error:** %s\n\n", markdownEscape(spec.Error))
+			}
+			if spec.Diff != "" {
+				fmt.Fprintf(&md, "```\n%s\n```\n\n", strings.TrimSuffix(spec.Diff, "\n"))
+			}
+			md.WriteString("</details>\n")
+		}
+	}
+
+	_, err := io.WriteString(w, md.String())
+	return err
+}
+
+// a readable name for a spec; uses fmt.Stringer if available
+func Describe(spec Specification) string {
+	if str, ok := spec.(fmt.Stringer); ok {
+		return str.String()
+	}
+
+	switch m := spec.(type) {
+	case *EnsureSpec:
+		return "ensure " + Describe(m.Spec)
+	case *RemoveSpec:
+		return "remove " + Describe(m.Spec)
+	case *ReplaceSpec:
+		return "replace " + Describe(m.Spec)
+	case *UnrestrictedSpec:
+		return "unrestricted " + Describe(m.Spec)
+	case *RetrySpec:
+		return Describe(m.Spec)
+	case *TaggedSpec:
+		return Describe(m.Spec)
+	}
+
+	return fmt.Sprintf("%T", spec)
+}
+
+// describe a built-in spec by its kind and identifying fields, skipping any
+// that are empty
+func describeFields(kind string, fields ...string) string {
+	fields = slices.DeleteFunc(append([]string{kind}, fields...), func(field string) bool {
+		return field == ""
+	})
+	return strings.Join(fields, " ")
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func markdownEscape(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "<", "&lt;", ">", "&gt;").Replace(text)
+}
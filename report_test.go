@@ -0,0 +1,195 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestBuildAllReport(t *testing.T) {
+	report := NewReport()
+	project := NewProject("report").
+		WithSpec(&TestSpec{check: true}).
+		WithSpec(&TestSpec{}).
+		WithSpec(&TestApplyErrorSpec{}).
+		WithSpec(&TestSpec{}).
+		Build()
+
+	if err := project.BuildAll(WithReport(report)); err == nil {
+		t.Fatal("expected error from BuildAll")
+	}
+
+	if len(report.Projects) != 1 {
+		t.Fatalf("expected 1 project, got %d", len(report.Projects))
+	}
+
+	result := report.Projects[0]
+	if result.Name != "report" || result.Error != "apply error" {
+		t.Fatalf("unexpected project report %+v", result)
+	}
+
+	expected := []Outcome{OutcomeUpToDate, OutcomeApplied, OutcomeFailed, OutcomeSkipped}
+	if len(result.Specs) != len(expected) {
+		t.Fatalf("expected %d specs, got %d", len(expected), len(result.Specs))
+	}
+
+	for idx, want := range expected {
+		if result.Specs[idx].Outcome != want {
+			t.Fatalf("expected spec %d to be %s, got %s", idx, want, result.Specs[idx].Outcome)
+		}
+	}
+
+	if result.Specs[2].Error != "apply error" {
+		t.Fatalf("unexpected spec error %q", result.Specs[2].Error)
+	}
+
+	if !report.Failed() {
+		t.Fatal("expected report to be failed")
+	}
+}
+
+func TestPlanReport(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.WriteFile(".env", []byte("A=1\nB=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report := NewReport()
+	project := NewProject("plan").
+		WithFS(fsys).
+		WithSpec(&EnvFileSpec{Path: ".env", Key: "A", Value: "1"}).
+		WithSpecPresent(&EnvFileSpec{Path: ".env", Key: "B", Value: "3"}).
+		WithSpec(&EnvFileSpec{Path: ".env", Key: "C", Value: "4"}).
+		Build()
+
+	drift, err := project.Plan(WithReport(report))
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	if len(drift) != 2 {
+		t.Fatalf("expected 2 drifted specs, got %d", len(drift))
+	}
+
+	specs := report.Projects[0].Specs
+	if specs[0].Outcome != OutcomeUpToDate || specs[1].Outcome != OutcomeDrift {
+		t.Fatalf("unexpected outcomes %s, %s", specs[0].Outcome, specs[1].Outcome)
+	}
+
+	if specs[1].Spec != "ensure envfile .env:B" {
+		t.Fatalf("unexpected spec name %s", specs[1].Spec)
+	}
+
+	if specs[1].Diff != ".env: B changed\n" || specs[2].Diff != ".env: C added\n" {
+		t.Fatalf("unexpected diffs %q, %q", specs[1].Diff, specs[2].Diff)
+	}
+
+	if report.Count(OutcomeDrift) != 2 || report.Failed() {
+		t.Fatal("expected drift without failure")
+	}
+
+	// planning must not change anything
+	data, _ := fsys.ReadFile(".env")
+	if string(data) != "A=1\nB=2\n" {
+		t.Fatalf("unexpected env file %q", data)
+	}
+}
+
+func TestReportWriters(t *testing.T) {
+	report := NewReport()
+	project := NewProject("writers").
+		WithSpec(&TestSpec{check: true}).
+		WithSpec(&TestSpec{}).
+		WithSpec(&TestCheckErrorSpec{}).
+		Build()
+
+	project.Plan(WithReport(report))
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteJSON(&buf); err != nil {
+			t.Fatalf("WriteJSON failed: %v", err)
+		}
+
+		var decoded Report
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+
+		if len(decoded.Projects) != 1 || len(decoded.Projects[0].Specs) != 3 {
+			t.Fatalf("unexpected JSON report: %s", buf.String())
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteJUnit(&buf); err != nil {
+			t.Fatalf("WriteJUnit failed: %v", err)
+		}
+
+		var suites struct {
+			Suites []struct {
+				Name     string `xml:"name,attr"`
+				Tests    int    `xml:"tests,attr"`
+				Failures int    `xml:"failures,attr"`
+				Errors   int    `xml:"errors,attr"`
+			} `xml:"testsuite"`
+		}
+
+		if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+
+		if len(suites.Suites) != 1 {
+			t.Fatalf("expected 1 suite, got %d", len(suites.Suites))
+		}
+
+		suite := suites.Suites[0]
+		if suite.Name != "writers" || suite.Tests != 3 || suite.Failures != 1 || suite.Errors != 1 {
+			t.Fatalf("unexpected suite %+v", suite)
+		}
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteMarkdown(&buf); err != nil {
+			t.Fatalf("WriteMarkdown failed: %v", err)
+		}
+
+		md := buf.String()
+		for _, want := range []string{"## writers", "| `*spec.TestSpec` | drift |", "**Error:** check error"} {
+			if !strings.Contains(md, want) {
+				t.Fatalf("expected markdown to contain %q:\n%s", want, md)
+			}
+		}
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	testCases := []struct {
+		spec Specification
+		want string
+	}{
+		{spec: &TestSpec{}, want: "*spec.TestSpec"},
+		{spec: &RemoveSpec{Spec: &TestSpec{}}, want: "remove *spec.TestSpec"},
+		{spec: Unrestricted(&ReplaceSpec{Spec: &TestSpec{}}), want: "unrestricted replace *spec.TestSpec"},
+		{spec: &RemoveSpec{Spec: &EnvFileSpec{Path: ".env", Key: "A"}}, want: "remove envfile .env:A"},
+		{spec: &PermissionSpec{Path: "bin/"}, want: "permission bin/"},
+		{spec: &ArchiveSpec{Source: "docs.zip", Dest: "site"}, want: "archive docs.zip site"},
+		{spec: &ExecSpec{CheckCommand: []string{"test", "-f", "done"}}, want: "exec test -f done"},
+		{spec: &GitCloneSpec{Dir: "vendor/lib"}, want: "git-clone vendor/lib"},
+		{spec: &GitCheckoutSpec{Ref: "main"}, want: "git-checkout main"},
+		{spec: &GitRemoteSpec{Name: "upstream"}, want: "git-remote upstream"},
+		{spec: &GitConfigSpec{Key: "core.autocrlf"}, want: "git-config core.autocrlf"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := Describe(tt.spec); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RetryPolicy retries Check and Apply when a spec fails with a transient error.
+// delays grow exponentially from Delay, up to MaxDelay.
+type RetryPolicy struct {
+	// total attempts for each call, including the first; values below 2
+	// disable retries
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// delay before the first retry, doubled for each retry after it
+	Delay time.Duration `yaml:"delay"`
+
+	// upper bound for the delay; zero means no bound
+	MaxDelay time.Duration `yaml:"max_delay"`
+
+	// fraction of each delay that is randomized, from 0 to 1
+	Jitter float64 `yaml:"jitter"`
+
+	// reports whether an error should be retried; every error is retried if
+	// this is nil.  see RetryOn and RetryOnType.
+	Retryable func(error) bool `yaml:"-"`
+}
+
+// RetrySpec applies the wrapped spec with its own retry policy, in place of
+// the project policy.
+type RetrySpec struct {
+	Spec   Specification
+	Policy RetryPolicy
+}
+
+func Retry(spec Specification, policy RetryPolicy) *RetrySpec {
+	return &RetrySpec{Spec: spec, Policy: policy}
+}
+
+// retry errors that match any of the targets, using errors.Is
+func RetryOn(targets ...error) func(error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// retry errors that wrap an error of type E, using errors.As
+func RetryOnType[E error]() func(error) bool {
+	return func(err error) bool {
+		var target E
+		return errors.As(err, &target)
+	}
+}
+
+func (p *RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("retry max_attempts must not be negative")
+	}
+
+	if p.Delay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// the delay before the given retry, starting at 1
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.Delay
+	for range retry - 1 {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+// call fn until it succeeds, the error is not retryable or attempts run out;
+// returns the number of retries made
+func retryCall(project *Project, spec Specification, policy *RetryPolicy, fn func() error) (int, error) {
+	err := fn()
+
+	retries := 0
+	for policy != nil && err != nil && retries+1 < policy.MaxAttempts {
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			break
+		}
+
+		retries++
+		delay := policy.backoff(retries)
+
+		log.Warn().Err(err).Str("project", project.Name).Type("spec", spec).Int("retry", retries).Dur("delay", delay).Msg("Retrying")
+
+		time.Sleep(delay)
+		err = fn()
+	}
+
+	return retries, err
+}
+
+// the policy for a spec; specs may override the project policy
+func (p *Project) retryPolicy(spec Specification) *RetryPolicy {
+	switch m := spec.(type) {
+	case *RetrySpec:
+		return &m.Policy
+	case *TaggedSpec:
+		return p.retryPolicy(m.Spec)
+	}
+	return p.Retry
+}
+
+func (r *RetrySpec) Check(project *Project) (bool, error) {
+	return r.Spec.Check(project)
+}
+
+func (r *RetrySpec) Apply(project *Project) error {
+	return r.Spec.Apply(project)
+}
+
+func (r *RetrySpec) Diff(project *Project) (string, error) {
+	return specDiff(project, r.Spec)
+}
+
+func (r *RetrySpec) Exists(project *Project) (bool, error) {
+	return specExists(project, r.Spec)
+}
+
+func (r *RetrySpec) Remove(project *Project) error {
+	return specRemove(project, r.Spec)
+}
+
+func (r *RetrySpec) Equals(project *Project) (bool, error) {
+	return specEquals(project, r.Spec)
+}
+
+func (r *RetrySpec) Replace(project *Project) error {
+	return specReplace(project, r.Spec)
+}
+
+func (r *RetrySpec) Snapshot(project *Project) (Snapshot, error) {
+	return snapshotSpec(project, r.Spec)
+}
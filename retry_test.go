@@ -0,0 +1,227 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errTestTransient = errors.New("transient error")
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond}
+
+	t.Run("recovers", func(t *testing.T) {
+		report := NewReport()
+		flaky := &TestFlakySpec{failures: 2, err: errTestTransient}
+		project := NewProject("retry").WithRetry(policy).WithSpec(flaky).Build()
+
+		if err := project.BuildAll(WithReport(report)); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		spec := report.Projects[0].Specs[0]
+		if spec.Outcome != OutcomeApplied || spec.Retries != 2 {
+			t.Fatalf("expected applied after 2 retries, got %+v", spec)
+		}
+
+		var md bytes.Buffer
+		if err := report.WriteMarkdown(&md); err != nil {
+			t.Fatalf("WriteMarkdown failed: %v", err)
+		}
+
+		if !strings.Contains(md.String(), "applied (2 retries)") {
+			t.Fatalf("expected retries in markdown:\n%s", md.String())
+		}
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		report := NewReport()
+		flaky := &TestFlakySpec{failures: 5, err: errTestTransient}
+		project := NewProject("retry").WithRetry(policy).WithSpec(flaky).Build()
+
+		if err := project.BuildAll(WithReport(report)); !errors.Is(err, errTestTransient) {
+			t.Fatalf("expected transient error, got %v", err)
+		}
+
+		if flaky.attempts != 3 || report.Projects[0].Specs[0].Retries != 2 {
+			t.Fatalf("expected 3 attempts, got %d", flaky.attempts)
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		policy := policy
+		policy.Retryable = RetryOn(errTestTransient)
+
+		flaky := &TestFlakySpec{failures: 1, err: errors.New("permanent error")}
+		project := NewProject("retry").WithRetry(policy).WithSpec(flaky).Build()
+
+		if err := project.BuildAll(); err == nil {
+			t.Fatal("expected error from BuildAll")
+		}
+
+		if flaky.attempts != 1 {
+			t.Fatalf("expected a single attempt, got %d", flaky.attempts)
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		flaky := &TestFlakySpec{failures: 1, err: errTestTransient, checkFails: true}
+		project := NewProject("retry").WithRetry(policy).WithSpec(flaky).Build()
+
+		drift, err := project.Plan()
+		if err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+
+		if len(drift) != 1 || flaky.attempts != 2 {
+			t.Fatalf("expected check to be retried, got %d attempts", flaky.attempts)
+		}
+	})
+
+	t.Run("spec policy", func(t *testing.T) {
+		flaky := &TestFlakySpec{failures: 1, err: errTestTransient}
+		project := NewProject("retry").WithSpec(Retry(flaky, policy)).Build()
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		if Describe(project.Specs[0]) != "*spec.TestFlakySpec" {
+			t.Fatalf("unexpected description %q", Describe(project.Specs[0]))
+		}
+	})
+
+	t.Run("no policy", func(t *testing.T) {
+		flaky := &TestFlakySpec{failures: 1, err: errTestTransient}
+		project := NewProject("retry").WithSpec(flaky).Build()
+
+		if err := project.BuildAll(); err == nil {
+			t.Fatal("expected error without a retry policy")
+		}
+	})
+
+	t.Run("modes without removal or replacement", func(t *testing.T) {
+		plain := Retry(&TestApplyErrorSpec{}, policy)
+		project := NewProject("plain").Build()
+
+		if ok, err := (&RemoveSpec{Spec: plain}).Check(project); err != nil || !ok {
+			t.Fatalf("expected the inverted Check fallback for removal, got %v (%v)", ok, err)
+		}
+
+		if ok, err := (&ReplaceSpec{Spec: plain}).Check(project); err != nil || ok {
+			t.Fatalf("expected the Check fallback for replacement, got %v (%v)", ok, err)
+		}
+	})
+}
+
+func TestRetryClassifiers(t *testing.T) {
+	wrapped := &ExecError{Result: &ExecResult{}, Err: &exec.ExitError{}}
+
+	if !RetryOnType[*ExecError]()(wrapped) {
+		t.Fatal("expected ExecError to match by type")
+	}
+
+	if RetryOnType[*ExecError]()(errTestTransient) {
+		t.Fatal("expected other errors not to match by type")
+	}
+
+	if !RetryOn(errTestTransient)(errors.Join(errors.New("other"), errTestTransient)) {
+		t.Fatal("expected wrapped target to match")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{Delay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond}
+
+	for retry, want := range map[int]time.Duration{1: 10, 2: 20, 3: 25, 10: 25} {
+		if got := policy.backoff(retry); got != want*time.Millisecond {
+			t.Fatalf("retry %d: expected %s, got %s", retry, want*time.Millisecond, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for range 100 {
+		if got := policy.backoff(1); got < 5*time.Millisecond || got > 10*time.Millisecond {
+			t.Fatalf("expected jittered delay between 5ms and 10ms, got %s", got)
+		}
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+projects:
+  - name: retry-config
+    retry: { max_attempts: 3, delay: 1s, max_delay: 30s, jitter: 0.2 }
+    specs:
+      - kind: envfile
+        mode: ensure
+        config: { path: .env, key: A }
+        retry: { max_attempts: 5 }
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+
+	projects, err := config.BuildProjects()
+	if err != nil {
+		t.Fatalf("BuildProjects failed: %v", err)
+	}
+
+	project := projects[0]
+	if project.Retry == nil || project.Retry.MaxAttempts != 3 || project.Retry.Delay != time.Second || project.Retry.Jitter != 0.2 {
+		t.Fatalf("unexpected project policy %+v", project.Retry)
+	}
+
+	retry, ok := project.Specs[0].(*RetrySpec)
+	if !ok {
+		t.Fatalf("expected *RetrySpec, got %T", project.Specs[0])
+	}
+
+	if retry.Policy.MaxAttempts != 5 {
+		t.Fatalf("unexpected spec policy %+v", retry.Policy)
+	}
+
+	if _, ok := retry.Spec.(*EnsureSpec); !ok {
+		t.Fatalf("expected retry to wrap the mode, got %T", retry.Spec)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		sc := SpecConfig{Kind: "envfile", Retry: &RetryPolicy{Jitter: 2}}
+		if _, err := sc.Build(); err == nil {
+			t.Fatal("expected error for invalid jitter")
+		}
+	})
+}
+
+// Test helpers
+
+// fails with err until it has been called failures times
+type TestFlakySpec struct {
+	failures   int
+	err        error
+	checkFails bool
+	attempts   int
+}
+
+func (s *TestFlakySpec) Check(project *Project) (bool, error) {
+	if s.checkFails {
+		return false, s.fail()
+	}
+	return false, nil
+}
+
+func (s *TestFlakySpec) Apply(project *Project) error {
+	return s.fail()
+}
+
+func (s *TestFlakySpec) fail() error {
+	s.attempts++
+	if s.attempts <= s.failures {
+		return s.err
+	}
+	return nil
+}
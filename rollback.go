@@ -0,0 +1,325 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// optional interface for specs that can undo Apply; the snapshot is taken
+// just before Apply and restored if the spec or a later one fails.  a nil
+// Snapshot means there is nothing that can be restored.
+type RollbackableSpec interface {
+	Snapshot(project *Project) (Snapshot, error)
+}
+
+// Snapshot restores the state captured before a spec was applied.
+type Snapshot interface {
+	Restore(project *Project) error
+}
+
+// RollbackObserver is an optional interface for observers that are notified
+// as applied specs are rolled back.  err is set if the spec could not be
+// restored.
+type RollbackObserver interface {
+	OnSpecRollback(project *Project, spec Specification, err error)
+}
+
+// FSSnapshot records files and directories in a WritableFS so they can be
+// restored later, including names that did not exist when it was taken.
+type FSSnapshot struct {
+	fsys  WritableFS
+	names []string
+
+	// recorded entries, in walk order so parents come before children
+	entries []snapshotEntry
+}
+
+type snapshotEntry struct {
+	name   string
+	mode   fs.FileMode
+	data   []byte
+	target string
+
+	uid, gid int
+	owned    bool
+}
+
+// a spec applied during a transaction, with its snapshot if it has one
+type appliedSpec struct {
+	spec     Specification
+	snapshot Snapshot
+}
+
+// roll back applied specs in reverse order if the project fails
+func WithTransaction() RunOption {
+	return func(cfg *runConfig) {
+		cfg.transaction = true
+	}
+}
+
+// take a snapshot of the named files and directory trees in fsys
+func SnapshotFS(fsys WritableFS, names ...string) (*FSSnapshot, error) {
+	snapshot := &FSSnapshot{fsys: fsys, names: names}
+
+	for _, name := range names {
+		info, err := fsys.Lstat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			if err := snapshot.record(name, info); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		err = fs.WalkDir(fsys, name, func(entryName string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			info, err := fsys.Lstat(entryName)
+			if err != nil {
+				return err
+			}
+
+			return snapshot.record(entryName, info)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// restore the recorded names, removing anything created since the snapshot
+func (s *FSSnapshot) Restore(project *Project) error {
+	recorded := map[string]*snapshotEntry{}
+	for idx := range s.entries {
+		recorded[s.entries[idx].name] = &s.entries[idx]
+	}
+
+	for _, name := range s.names {
+		if err := s.removeChanged(name, recorded); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range s.entries {
+		if err := s.restoreEntry(&entry); err != nil {
+			return err
+		}
+	}
+
+	// modes are applied deepest first, so read-only directories are restored
+	// after their contents
+	for _, entry := range slices.Backward(s.entries) {
+		if err := s.restoreOwner(&entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FSSnapshot) record(name string, info fs.FileInfo) error {
+	entry := snapshotEntry{name: name, mode: info.Mode()}
+	entry.uid, entry.gid, entry.owned = fileOwner(info)
+
+	var err error
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		entry.target, err = s.fsys.ReadLink(name)
+	case info.Mode().IsRegular():
+		entry.data, err = s.fsys.ReadFile(name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// remove entries below name that were not recorded or changed type
+func (s *FSSnapshot) removeChanged(name string, recorded map[string]*snapshotEntry) error {
+	info, err := s.fsys.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if entry := recorded[name]; entry == nil || entry.mode.Type() != info.Mode().Type() {
+		return s.fsys.RemoveAll(name)
+	} else if !info.IsDir() {
+		return nil
+	}
+
+	stale := []string{}
+	err = fs.WalkDir(s.fsys, name, func(entryName string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if want := recorded[entryName]; want == nil || want.mode.Type() != entry.Type() {
+			stale = append(stale, entryName)
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entryName := range stale {
+		if err := s.fsys.RemoveAll(entryName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recreate a single entry if it is missing or its content changed
+func (s *FSSnapshot) restoreEntry(entry *snapshotEntry) error {
+	_, err := s.fsys.Lstat(entry.name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	switch {
+	case entry.mode.IsDir():
+		if exists {
+			return nil
+		}
+		if err := s.fsys.MkdirAll(path.Dir(entry.name), 0o755); err != nil {
+			return err
+		}
+		return s.fsys.Mkdir(entry.name, 0o700)
+
+	case entry.mode&fs.ModeSymlink != 0:
+		if exists {
+			target, err := s.fsys.ReadLink(entry.name)
+			if err != nil || target == entry.target {
+				return err
+			}
+			if err := s.fsys.Remove(entry.name); err != nil {
+				return err
+			}
+		}
+		return s.fsys.Symlink(entry.target, entry.name)
+
+	case entry.mode.IsRegular():
+		if exists {
+			data, err := s.fsys.ReadFile(entry.name)
+			if err != nil || bytes.Equal(data, entry.data) {
+				return err
+			}
+
+			// the file may have been made read-only since the snapshot
+			if err := s.fsys.Remove(entry.name); err != nil {
+				return err
+			}
+		}
+		return s.fsys.WriteFile(entry.name, entry.data, 0o600)
+	}
+
+	log.Debug().Str("name", entry.name).Stringer("mode", entry.mode).Msg("Unable to restore special file")
+	return nil
+}
+
+func (s *FSSnapshot) restoreOwner(entry *snapshotEntry) error {
+	info, err := s.fsys.Lstat(entry.name)
+	if err != nil {
+		return err
+	}
+
+	if entry.owned {
+		if uid, gid, ok := fileOwner(info); ok && (uid != entry.uid || gid != entry.gid) {
+			if err := s.fsys.Lchown(entry.name, entry.uid, entry.gid); err != nil {
+				return err
+			}
+		}
+	}
+
+	// symlink permissions are not meaningful on most platforms
+	if entry.mode&fs.ModeSymlink != 0 || info.Mode()&permMask == entry.mode&permMask {
+		return nil
+	}
+
+	return s.fsys.Chmod(entry.name, entry.mode&permMask)
+}
+
+// several snapshots restored in reverse order
+type snapshots []Snapshot
+
+func (s snapshots) Restore(project *Project) error {
+	for _, snapshot := range slices.Backward(s) {
+		if err := snapshot.Restore(project); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take a snapshot if the spec supports it; returns nil if it does not
+func snapshotSpec(project *Project, spec Specification) (Snapshot, error) {
+	if rb, ok := spec.(RollbackableSpec); ok {
+		return rb.Snapshot(project)
+	}
+	return nil, nil
+}
+
+// restore applied specs in reverse order, notifying observers of each one
+func (r *runConfig) rollback(project *Project) error {
+	errs := []error{}
+
+	for _, applied := range slices.Backward(r.applied) {
+		started := time.Now()
+
+		var err error
+		if applied.snapshot == nil {
+			err = fmt.Errorf("spec type %T does not support rollback", applied.spec)
+		} else {
+			err = applied.snapshot.Restore(project)
+		}
+
+		if err != nil {
+			log.Warn().Err(err).Str("project", project.Name).Type("spec", applied.spec).Msg("Unable to roll back")
+			errs = append(errs, err)
+		} else {
+			log.Info().Str("project", project.Name).Type("spec", applied.spec).Dur("duration", time.Since(started)).Msg("Rolled back")
+		}
+
+		for _, observer := range r.observers {
+			if rb, ok := observer.(RollbackObserver); ok {
+				rb.OnSpecRollback(project, applied.spec, err)
+			}
+		}
+	}
+
+	r.applied = nil
+
+	if len(errs) > 0 {
+		return fmt.Errorf("rollback incomplete: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
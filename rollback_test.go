@@ -0,0 +1,330 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	setup := func(t *testing.T) (*MemFS, *ProjectBuilder) {
+		fsys := NewMemFS()
+		if err := fsys.WriteFile(".env", []byte("A=0\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		project := NewProject("transaction").
+			WithFS(fsys).
+			WithSpec(&EnvFileSpec{Path: ".env", Key: "A", Value: "1"}).
+			WithSpec(&EnvFileSpec{Path: "other.env", Key: "B", Value: "2"})
+
+		return fsys, project
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		fsys, builder := setup(t)
+		project := builder.WithSpec(&TestApplyErrorSpec{}).Build()
+		report := NewReport()
+
+		if err := project.BuildAll(WithTransaction(), WithReport(report)); err == nil {
+			t.Fatal("expected error from BuildAll")
+		}
+
+		data, _ := fsys.ReadFile(".env")
+		if string(data) != "A=0\n" {
+			t.Fatalf("expected env file to be restored, got:\n%s", data)
+		}
+
+		if _, err := fsys.Stat("other.env"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal("expected created env file to be removed")
+		}
+
+		outcomes := []Outcome{}
+		for _, spec := range report.Projects[0].Specs {
+			outcomes = append(outcomes, spec.Outcome)
+		}
+
+		expected := []Outcome{OutcomeRolledBack, OutcomeRolledBack, OutcomeFailed}
+		if !slices.Equal(outcomes, expected) {
+			t.Fatalf("expected outcomes %v, got %v", expected, outcomes)
+		}
+	})
+
+	t.Run("without transaction", func(t *testing.T) {
+		fsys, builder := setup(t)
+		project := builder.WithSpec(&TestApplyErrorSpec{}).Build()
+
+		if err := project.BuildAll(); err == nil {
+			t.Fatal("expected error from BuildAll")
+		}
+
+		data, _ := fsys.ReadFile(".env")
+		if string(data) != "A=1\n" {
+			t.Fatalf("expected env file to remain applied, got:\n%s", data)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		fsys, builder := setup(t)
+		project := builder.Build()
+
+		if err := project.BuildAll(WithTransaction()); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		data, _ := fsys.ReadFile("other.env")
+		if string(data) != "B=2\n" {
+			t.Fatalf("unexpected env file:\n%s", data)
+		}
+	})
+
+	t.Run("not rollbackable", func(t *testing.T) {
+		_, builder := setup(t)
+		project := builder.WithSpec(&TestSpec{}).WithSpec(&TestApplyErrorSpec{}).Build()
+		report := NewReport()
+
+		err := project.BuildAll(WithTransaction(), WithReport(report))
+		if err == nil || !strings.Contains(err.Error(), "rollback incomplete") {
+			t.Fatalf("expected incomplete rollback, got %v", err)
+		}
+
+		spec := report.Projects[0].Specs[2]
+		if spec.Outcome != OutcomeApplied || !strings.Contains(spec.Error, "does not support rollback") {
+			t.Fatalf("expected spec to remain applied, got %+v", spec)
+		}
+
+		if report.Projects[0].Specs[1].Outcome != OutcomeRolledBack {
+			t.Fatal("expected earlier specs to be rolled back")
+		}
+	})
+
+	t.Run("failed spec", func(t *testing.T) {
+		fsys := NewMemFS()
+		project := NewProject("partial").WithFS(fsys).WithSpec(&TestPartialApplySpec{Path: "partial"}).Build()
+
+		if err := project.BuildAll(WithTransaction()); err == nil {
+			t.Fatal("expected error from BuildAll")
+		}
+
+		if _, err := fsys.Stat("partial"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal("expected partial changes of the failed spec to be removed")
+		}
+	})
+
+	t.Run("state", func(t *testing.T) {
+		_, builder := setup(t)
+		store := NewFileStateStore("")
+		project := builder.WithStateStore(store).WithSpec(&TestApplyErrorSpec{}).Build()
+
+		if err := project.BuildAll(WithTransaction()); err == nil {
+			t.Fatal("expected error from BuildAll")
+		}
+
+		state, err := store.Load(project)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+
+		if len(state.Specs) != 0 {
+			t.Fatalf("expected rolled back specs to be forgotten, got %d", len(state.Specs))
+		}
+	})
+}
+
+func TestSnapshotFS(t *testing.T) {
+	filesystems := map[string]func() WritableFS{
+		"memfs": func() WritableFS { return NewMemFS() },
+		"osfs":  func() WritableFS { return NewOSFS(t.TempDir()) },
+	}
+
+	for name, newFS := range filesystems {
+		t.Run(name, func(t *testing.T) {
+			testSnapshotFS(t, newFS())
+		})
+	}
+}
+
+func testSnapshotFS(t *testing.T, fsys WritableFS) {
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	must(fsys.MkdirAll("dir/sub", 0o755))
+	must(fsys.WriteFile("dir/a", []byte("a"), 0o644))
+	must(fsys.WriteFile("dir/sub/b", []byte("b"), 0o644))
+	must(fsys.Symlink("a", "dir/link"))
+	must(fsys.Chmod("dir/sub", 0o750))
+
+	snapshot, err := SnapshotFS(fsys, "dir", "new.txt")
+	if err != nil {
+		t.Fatalf("SnapshotFS failed: %v", err)
+	}
+
+	must(fsys.WriteFile("dir/a", []byte("changed"), 0o644))
+	must(fsys.Chmod("dir/a", 0o600))
+	must(fsys.RemoveAll("dir/sub"))
+	must(fsys.WriteFile("dir/c", []byte("c"), 0o644))
+	must(fsys.Remove("dir/link"))
+	must(fsys.Symlink("c", "dir/link"))
+	must(fsys.WriteFile("new.txt", []byte("new"), 0o644))
+
+	if err := snapshot.Restore(NewProject("snapshot").WithFS(fsys).Build()); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	t.Run("contents", func(t *testing.T) {
+		for name, want := range map[string]string{"dir/a": "a", "dir/sub/b": "b"} {
+			data, err := fsys.ReadFile(name)
+			if err != nil || string(data) != want {
+				t.Fatalf("expected %s to contain %q, got %q (%v)", name, want, data, err)
+			}
+		}
+	})
+
+	t.Run("modes", func(t *testing.T) {
+		for name, want := range map[string]fs.FileMode{"dir/a": 0o644, "dir/sub": fs.ModeDir | 0o750} {
+			info, err := fsys.Stat(name)
+			if err != nil || info.Mode() != want {
+				t.Fatalf("expected %s to have mode %s, got %v (%v)", name, want, info.Mode(), err)
+			}
+		}
+	})
+
+	t.Run("symlinks", func(t *testing.T) {
+		target, err := fsys.ReadLink("dir/link")
+		if err != nil || target != "a" {
+			t.Fatalf("expected link to a, got %q (%v)", target, err)
+		}
+	})
+
+	t.Run("created", func(t *testing.T) {
+		for _, name := range []string{"dir/c", "new.txt"} {
+			if _, err := fsys.Lstat(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected %s to be removed", name)
+			}
+		}
+	})
+}
+
+func TestPermissionSnapshot(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.WriteFile("run.sh", []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	project := NewProject("perm").WithFS(fsys).Build()
+	spec := &PermissionSpec{Path: "run.sh", Mode: Ptr(fs.FileMode(0o755))}
+
+	snapshot, err := spec.Snapshot(project)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	if err := spec.Apply(project); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if err := snapshot.Restore(project); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	info, _ := fsys.Stat("run.sh")
+	if info.Mode() != 0o644 {
+		t.Fatalf("expected mode to be restored, got %s", info.Mode())
+	}
+}
+
+func TestArchiveSnapshot(t *testing.T) {
+	fsys := NewMemFS()
+	for name, content := range map[string]string{".git/HEAD": "ref: main", "README": "mine"} {
+		if err := fsys.MkdirAll(path.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	project := NewProject("archive").WithFS(fsys).Build()
+	spec := &ArchiveSpec{Source: "docs.zip"}
+
+	if err := fsys.WriteFile("docs.zip", buildTestZip(t, map[string]string{"old.txt": "old"}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Apply(project); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	data := buildTestZip(t, map[string]string{"README": "theirs", "docs/index.md": "# docs"})
+	if err := fsys.WriteFile("docs.zip", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := spec.Snapshot(project)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// only the previous files, the new entries and the manifest are recorded
+	names := []string{}
+	for _, snapshot := range snapshot.(snapshots) {
+		names = append(names, snapshot.(*FSSnapshot).names...)
+	}
+	slices.Sort(names)
+
+	expected := []string{".docs.zip.manifest.json", "README", "docs", "old.txt"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("expected snapshot of %v, got %v", expected, names)
+	}
+
+	if err := spec.Apply(project); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// files created by others are not part of the rollback
+	if err := fsys.WriteFile("notes.txt", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := snapshot.Restore(project); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	for name, want := range map[string]string{"README": "mine", "old.txt": "old", ".git/HEAD": "ref: main", "notes.txt": ""} {
+		if data, err := fsys.ReadFile(name); err != nil || string(data) != want {
+			t.Fatalf("expected %s to contain %q, got %q (%v)", name, want, data, err)
+		}
+	}
+
+	if _, err := fsys.Stat("docs"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected extracted directory to be removed, got %v", err)
+	}
+}
+
+// Test helpers
+
+// writes a file, then fails
+type TestPartialApplySpec struct {
+	Path string
+}
+
+func (s *TestPartialApplySpec) Check(project *Project) (bool, error) {
+	return false, nil
+}
+
+func (s *TestPartialApplySpec) Apply(project *Project) error {
+	if err := project.FS.WriteFile(s.Path, []byte("partial"), 0o644); err != nil {
+		return err
+	}
+	return errors.New("apply error")
+}
+
+func (s *TestPartialApplySpec) Snapshot(project *Project) (Snapshot, error) {
+	return SnapshotFS(project.FS, s.Path)
+}
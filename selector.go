@@ -0,0 +1,255 @@
+package spec
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// the selector key that matches the project name rather than a label
+const SelectorName = "name"
+
+// Selector chooses projects by their labels and names, or blueprints by
+// project facts.  see ParseSelector.
+type Selector struct {
+	requirements []requirement
+}
+
+type selectorOp string
+
+const (
+	opEquals    selectorOp = "="
+	opNotEquals selectorOp = "!="
+	opIn        selectorOp = "in"
+	opNotIn     selectorOp = "notin"
+	opExists    selectorOp = "exists"
+	opNotExists selectorOp = "!"
+)
+
+// a single term of a selector; values are glob patterns
+type requirement struct {
+	key    string
+	op     selectorOp
+	values []string
+}
+
+// parse a comma-separated selector; every term must match.  terms are:
+//
+//	key=value        the label matches value
+//	key!=value       the label is missing or does not match value
+//	key in (a,b)     the label matches one of the values
+//	key notin (a,b)  the label is missing or matches none of the values
+//	key              the label is set
+//	!key             the label is not set
+//
+// values may be glob patterns, as in path.Match, and the key "name" matches
+// the project name, e.g. name=api-*.
+func ParseSelector(expr string) (*Selector, error) {
+	selector := &Selector{}
+
+	terms, err := splitSelector(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", expr, err)
+	}
+
+	for _, term := range terms {
+		req, err := parseRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", expr, err)
+		}
+		selector.requirements = append(selector.requirements, req)
+	}
+
+	return selector, nil
+}
+
+// report whether the project labels and name match every term of the
+// selector; a nil or empty selector matches all projects
+func (s *Selector) Matches(project *Project) bool {
+	return s.matches(func(key string) (string, bool) {
+		if key == SelectorName {
+			return project.Name, true
+		}
+		value, ok := project.Labels[key]
+		return value, ok
+	})
+}
+
+// report whether the facts match every term of the selector; the name key has
+// no special meaning for facts
+func (s *Selector) MatchesFacts(facts map[string]string) bool {
+	return s.matches(func(key string) (string, bool) {
+		value, ok := facts[key]
+		return value, ok
+	})
+}
+
+func (s *Selector) matches(lookup func(key string) (string, bool)) bool {
+	if s == nil {
+		return true
+	}
+
+	for _, req := range s.requirements {
+		if !req.matches(lookup) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Selector) String() string {
+	if s == nil {
+		return ""
+	}
+
+	terms := []string{}
+	for _, req := range s.requirements {
+		terms = append(terms, req.String())
+	}
+	return strings.Join(terms, ",")
+}
+
+func (r requirement) matches(lookup func(key string) (string, bool)) bool {
+	value, ok := lookup(r.key)
+
+	switch r.op {
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	case opEquals, opIn:
+		return ok && matchAny(r.values, value)
+	case opNotEquals, opNotIn:
+		return !ok || !matchAny(r.values, value)
+	}
+
+	return false
+}
+
+func (r requirement) String() string {
+	switch r.op {
+	case opExists:
+		return r.key
+	case opNotExists:
+		return "!" + r.key
+	case opIn, opNotIn:
+		return fmt.Sprintf("%s %s (%s)", r.key, r.op, strings.Join(r.values, ","))
+	}
+	return r.key + string(r.op) + r.values[0]
+}
+
+func matchAny(patterns []string, value string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, value)
+		return ok
+	})
+}
+
+// split a selector on commas outside of parentheses
+func splitSelector(expr string) ([]string, error) {
+	terms := []string{}
+	if strings.TrimSpace(expr) == "" {
+		return terms, nil
+	}
+
+	depth, start := 0, 0
+	for idx, ch := range expr {
+		switch ch {
+		case '(':
+			depth++
+			if depth > 1 {
+				return nil, fmt.Errorf("nested parentheses")
+			}
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				terms = append(terms, strings.TrimSpace(expr[start:idx]))
+				start = idx + 1
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+
+	return append(terms, strings.TrimSpace(expr[start:])), nil
+}
+
+func parseRequirement(term string) (requirement, error) {
+	if term == "" {
+		return requirement{}, fmt.Errorf("empty term")
+	}
+
+	if key, ok := strings.CutPrefix(term, "!"); ok && !strings.Contains(key, "=") {
+		key = strings.TrimSpace(key)
+		return requirement{key: key, op: opNotExists}, validateLabelKey(key)
+	}
+
+	if open := strings.Index(term, "("); open >= 0 {
+		fields := strings.Fields(term[:open])
+		if len(fields) != 2 || (fields[1] != string(opIn) && fields[1] != string(opNotIn)) || !strings.HasSuffix(term, ")") {
+			return requirement{}, fmt.Errorf("expected key in (values) or key notin (values) in %q", term)
+		}
+
+		values := []string{}
+		for value := range strings.SplitSeq(term[open+1:len(term)-1], ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+
+		req := requirement{key: fields[0], op: selectorOp(fields[1]), values: values}
+		return req, req.validate()
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if key, value, ok := strings.Cut(term, op); ok {
+			kind := opEquals
+			if op == "!=" {
+				kind = opNotEquals
+			}
+
+			req := requirement{key: strings.TrimSpace(key), op: kind, values: []string{strings.TrimSpace(value)}}
+			return req, req.validate()
+		}
+	}
+
+	return requirement{key: term, op: opExists}, validateLabelKey(term)
+}
+
+func (r requirement) validate() error {
+	if err := validateLabelKey(r.key); err != nil {
+		return err
+	}
+
+	for _, value := range r.values {
+		if strings.ContainsAny(value, "=!(), ") {
+			return fmt.Errorf("invalid value %q for %s", value, r.key)
+		}
+
+		if _, err := path.Match(value, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q for %s: %w", value, r.key, err)
+		}
+	}
+
+	return nil
+}
+
+// label keys may not be empty or contain spaces or selector operators
+func validateLabelKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("empty label key")
+	}
+
+	if strings.ContainsFunc(key, func(r rune) bool { return unicode.IsSpace(r) || strings.ContainsRune("=!(),", r) }) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+
+	return nil
+}
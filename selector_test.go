@@ -0,0 +1,114 @@
+package spec
+
+import "testing"
+
+func TestParseSelector(t *testing.T) {
+	api := NewProject("api-server").WithLabel("team", "platform").WithLabel("lang", "go").Build()
+	web := NewProject("web").WithLabel("team", "frontend").WithLabel("lang", "typescript").WithLabel("tier", "1").Build()
+	tool := NewProject("tool").WithLabel("lang", "rust").Build()
+
+	tests := []struct {
+		expr string
+		want []*Project
+	}{
+		{"", []*Project{api, web, tool}},
+		{"team=platform", []*Project{api}},
+		{"team==platform", []*Project{api}},
+		{"team!=platform", []*Project{web, tool}},
+		{"lang in (go,rust)", []*Project{api, tool}},
+		{"team=platform,lang in (go, rust)", []*Project{api}},
+		{"lang notin (go,rust)", []*Project{web}},
+		{"tier", []*Project{web}},
+		{"!tier", []*Project{api, tool}},
+		{"name=api-*", []*Project{api}},
+		{"name in (web,t*)", []*Project{web, tool}},
+		{"lang=*script", []*Project{web}},
+	}
+
+	for _, test := range tests {
+		selector, err := ParseSelector(test.expr)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q) failed: %v", test.expr, err)
+		}
+
+		got := []*Project{}
+		for _, project := range []*Project{api, web, tool} {
+			if selector.Matches(project) {
+				got = append(got, project)
+			}
+		}
+
+		if len(got) != len(test.want) {
+			t.Fatalf("%q: expected %d projects, got %d", test.expr, len(test.want), len(got))
+		}
+
+		for idx := range got {
+			if got[idx] != test.want[idx] {
+				t.Fatalf("%q: expected %s, got %s", test.expr, test.want[idx].Name, got[idx].Name)
+			}
+		}
+	}
+
+	t.Run("string", func(t *testing.T) {
+		selector, err := ParseSelector("team = platform, lang in (go,rust),!tier,name!=web")
+		if err != nil {
+			t.Fatalf("ParseSelector failed: %v", err)
+		}
+
+		if selector.String() != "team=platform,lang in (go,rust),!tier,name!=web" {
+			t.Fatalf("unexpected string %q", selector.String())
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, expr := range []string{"team=a,", "lang in (go", "lang in go,rust)", "lang is (go)", "=go", "!team=a", "lang in ((go))", "team=[", "my team=a"} {
+			if _, err := ParseSelector(expr); err == nil {
+				t.Fatalf("expected error for %q", expr)
+			}
+		}
+	})
+}
+
+func TestSelectProjects(t *testing.T) {
+	registry := NewRegistry()
+	registry.Projects.Register(NewProject("select-a").WithLabel("team", "platform").Build())
+	registry.Projects.Register(NewProject("select-b").WithLabel("team", "data").Build())
+
+	selector, err := ParseSelector("team=platform")
+	if err != nil {
+		t.Fatalf("ParseSelector failed: %v", err)
+	}
+
+	projects := registry.Projects.Select(selector)
+	if len(projects) != 1 || projects[0].Name != "select-a" {
+		t.Fatalf("expected select-a, got %d projects", len(projects))
+	}
+
+	if len(registry.Projects.Select(nil)) != 2 {
+		t.Fatal("expected a nil selector to match every project")
+	}
+
+	t.Run("config", func(t *testing.T) {
+		config, err := ParseConfig([]byte(`
+projects:
+  - name: select-config
+    labels: { team: platform, lang: go }
+`))
+		if err != nil {
+			t.Fatalf("ParseConfig failed: %v", err)
+		}
+
+		if err := registry.RegisterConfig(config); err != nil {
+			t.Fatalf("RegisterConfig failed: %v", err)
+		}
+
+		if projects := registry.Projects.Select(selector); len(projects) != 2 || projects[1].Labels["lang"] != "go" {
+			t.Fatal("expected labels from config")
+		}
+
+		bad := ProjectConfig{Name: "bad-labels", Labels: map[string]string{"my team": "a"}}
+		if _, err := registry.BuildProject(&bad, ""); err == nil {
+			t.Fatal("expected error for an invalid label key")
+		}
+	})
+}
@@ -2,6 +2,11 @@ package spec
 
 import (
 	"fmt"
+	"maps"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/rs/zerolog/log"
@@ -16,57 +21,418 @@ type Specification interface {
 
 type SpecRegistry struct {
 	lock  sync.RWMutex
-	specs map[string]SpecFactory
+	specs map[string]*specEntry
+
+	// spec kinds registered with RegisterSpecType, by pointer type
+	kinds map[reflect.Type]string
+
+	policy DuplicatePolicy
+}
+
+// SpecInfo describes a registered spec kind.
+type SpecInfo struct {
+	Name        string
+	Description string
+
+	// prefix of a namespaced name, e.g. acme for acme/file
+	Namespace string
+
+	// type that config is decoded into, for specs registered with
+	// RegisterSpecType; nil for other factories
+	ConfigType reflect.Type
+
+	// import path of the package defining ConfigType, or that registered the
+	// factory
+	Package string
+}
+
+// SpecOption sets optional metadata when registering a spec.
+type SpecOption func(*SpecInfo)
+
+type specEntry struct {
+	factory  SpecFactory
+	info     SpecInfo
+	location string
+}
+
+func newSpecRegistry() *SpecRegistry {
+	return &SpecRegistry{
+		specs: make(map[string]*specEntry),
+		kinds: make(map[reflect.Type]string),
+	}
+}
+
+// the spec kinds in the default registry
+func Specs() *SpecRegistry {
+	return defaultRegistry.Specs
 }
 
-var specRegistry = &SpecRegistry{
-	specs: make(map[string]SpecFactory),
+// describe the spec kind, e.g. for listings
+func WithSpecDescription(description string) SpecOption {
+	return func(info *SpecInfo) {
+		info.Description = description
+	}
+}
+
+// add a spec factory to the default registry; see SpecRegistry.Register
+func RegisterSpec(name string, factory SpecFactory, opts ...SpecOption) error {
+	return defaultRegistry.Specs.register(name, factory, newSpecInfo(name, nil, callerPackage(1), opts), callerLocation(1))
+}
+
+// register a spec type in the default registry; see RegisterSpecTypeIn
+func RegisterSpecType[T any, P interface {
+	*T
+	Specification
+}](name string, opts ...SpecOption) error {
+	return registerSpecTypeIn[T, P](defaultRegistry.Specs, name, callerLocation(1), opts...)
+}
+
+// register a spec type whose config is decoded into a new *T; config may also
+// be a T or *T, which is used directly.  duplicate names are handled by the
+// registry's duplicate policy.
+func RegisterSpecTypeIn[T any, P interface {
+	*T
+	Specification
+}](registry *SpecRegistry, name string, opts ...SpecOption) error {
+	return registerSpecTypeIn[T, P](registry, name, callerLocation(1), opts...)
 }
 
-func RegisterSpec(name string, factory SpecFactory) {
+func registerSpecTypeIn[T any, P interface {
+	*T
+	Specification
+}](registry *SpecRegistry, name string, location string, opts ...SpecOption) error {
 	log.Trace().Str("spec", name).Msg("Registering specification")
-	specRegistry.lock.Lock()
-	defer specRegistry.lock.Unlock()
-	specRegistry.specs[name] = factory
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	return registerSpecType[T, P](registry, name, location, opts...)
 }
 
+// add a spec type to the registry; the caller must hold the lock
+func registerSpecType[T any, P interface {
+	*T
+	Specification
+}](registry *SpecRegistry, name string, location string, opts ...SpecOption) error {
+	typ := reflect.TypeFor[T]()
+	info := newSpecInfo(name, typ, typ.PkgPath(), opts)
+
+	if err := registry.add(name, specTypeFactory[T, P](name), info, location); err != nil {
+		return err
+	}
+
+	registry.kinds[reflect.TypeFor[P]()] = name
+	return nil
+}
+
+func specTypeFactory[T any, P interface {
+	*T
+	Specification
+}](name string) SpecFactory {
+	return func(config any) (Specification, error) {
+		switch c := config.(type) {
+		case *T:
+			return P(c), nil
+		case T:
+			return P(&c), nil
+		}
+
+		spec := P(new(T))
+		if err := DecodeConfig(config, spec); err != nil {
+			return nil, fmt.Errorf("invalid config for %s: %w", name, err)
+		}
+
+		return spec, nil
+	}
+}
+
+func newSpecInfo(name string, typ reflect.Type, pkg string, opts []SpecOption) SpecInfo {
+	namespace, _ := SplitName(name)
+	info := SpecInfo{Name: name, Namespace: namespace, ConfigType: typ, Package: pkg}
+	for _, opt := range opts {
+		opt(&info)
+	}
+	return info
+}
+
+// create a spec from the default registry
 func CreateSpec(name string, config any) (Specification, error) {
-	factory, ok := specRegistry.specs[name]
+	return defaultRegistry.Specs.Create(name, config)
+}
+
+// return the kind a spec type was registered as in the default registry
+func SpecKind(spec Specification) (string, bool) {
+	return defaultRegistry.Specs.Kind(spec)
+}
+
+// return the sorted names of all specs in the default registry
+func ListSpecs() []string {
+	return defaultRegistry.Specs.List()
+}
+
+// create a spec, decoding config for the registered kind
+func (r *SpecRegistry) Create(name string, config any) (Specification, error) {
+	factory, ok := r.Get(name)
 	if !ok {
 		return nil, fmt.Errorf("specification %s not found", name)
 	}
 	return factory(config)
 }
 
+// return the kind a spec type was registered as with RegisterSpecType
+func (r *SpecRegistry) Kind(spec Specification) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	kind, ok := r.kinds[reflect.TypeOf(spec)]
+	return kind, ok
+}
+
+// set how specs registered under an existing name are handled
+func (r *SpecRegistry) SetDuplicatePolicy(policy DuplicatePolicy) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.policy = policy
+}
+
+// add a spec factory; names may be namespaced, e.g. acme/file.  duplicate
+// names are handled by the registry's duplicate policy.
+func (r *SpecRegistry) Register(name string, factory SpecFactory, opts ...SpecOption) error {
+	return r.register(name, factory, newSpecInfo(name, nil, callerPackage(1), opts), callerLocation(1))
+}
+
+func (r *SpecRegistry) register(name string, factory SpecFactory, info SpecInfo, location string) error {
+	log.Trace().Str("spec", name).Msg("Registering specification")
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.add(name, factory, info, location)
+}
+
+// add a spec, replacing an existing spec unless the duplicate policy forbids
+// it; the caller must hold the lock
+func (r *SpecRegistry) add(name string, factory SpecFactory, info SpecInfo, location string) error {
+	if err := validateName("spec", name); err != nil {
+		return err
+	}
+
+	if existing, ok := r.specs[name]; ok {
+		duplicate := &DuplicateNameError{Type: "spec", Name: name, Location: location, Existing: existing.location}
+		if err := r.policy.resolve(duplicate); err != nil {
+			return err
+		}
+	}
+
+	// the name no longer refers to a registered type
+	r.unregister(name)
+	r.specs[name] = &specEntry{factory: factory, info: info, location: location}
+	return nil
+}
+
+// remove a spec; returns false if it was not registered
+func (r *SpecRegistry) Unregister(name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.unregister(name)
+}
+
+// remove a spec and its type; the caller must hold the lock
+func (r *SpecRegistry) unregister(name string) bool {
+	maps.DeleteFunc(r.kinds, func(_ reflect.Type, kind string) bool {
+		return kind == name
+	})
+
+	_, ok := r.specs[name]
+	delete(r.specs, name)
+	return ok
+}
+
+// return the factory for a spec
+func (r *SpecRegistry) Get(name string) (SpecFactory, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.specs[name]
+	if !ok {
+		return nil, false
+	}
+	return entry.factory, true
+}
+
+func (r *SpecRegistry) Has(name string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.specs[name]
+	return ok
+}
+
+// return the metadata for a spec
+func (r *SpecRegistry) Info(name string) (SpecInfo, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, ok := r.specs[name]
+	if !ok {
+		return SpecInfo{}, false
+	}
+	return entry.info, true
+}
+
+// return the sorted names of all registered specs
+func (r *SpecRegistry) List() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return slices.Sorted(maps.Keys(r.specs))
+}
+
+// return the metadata for all registered specs, sorted by name
+func (r *SpecRegistry) Infos() []SpecInfo {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	infos := []SpecInfo{}
+	for _, name := range slices.Sorted(maps.Keys(r.specs)) {
+		infos = append(infos, r.specs[name].info)
+	}
+	return infos
+}
+
+// return the import path of the package of a calling function; skip is the
+// number of frames above the caller of callerPackage
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+
+	// function names are the package path followed by a dot and the
+	// function, e.g. github.com/org/repo/pkg.(*Type).Method
+	name := fn.Name()
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+// DeferredSpec builds its spec from the project when it is first used, e.g.
+// to read project vars.  the spec is resolved once for each project (copies
+// made by Unrestricted share it); later calls use the same spec, or return
+// the same error.  use Forget to drop the result for a project.
 type DeferredSpec struct {
-	SpecFunc func() Specification
+	SpecFunc func(project *Project) (Specification, error)
+
+	lock     sync.Mutex
+	resolved map[*Project]*deferredResult
+}
+
+type deferredResult struct {
+	once sync.Once
+	spec Specification
+	err  error
+}
 
-	lock sync.Mutex
-	spec *Specification
+func Defer(fn func(project *Project) (Specification, error)) *DeferredSpec {
+	return &DeferredSpec{SpecFunc: fn}
 }
 
-func (d *DeferredSpec) init() {
+// return the spec for the project, building it on first use
+func (d *DeferredSpec) Resolve(project *Project) (Specification, error) {
+	d.lock.Lock()
+	if d.resolved == nil {
+		d.resolved = map[*Project]*deferredResult{}
+	}
+
+	result, ok := d.resolved[project.original()]
+	if !ok {
+		result = &deferredResult{}
+		d.resolved[project.original()] = result
+	}
+	d.lock.Unlock()
+
+	result.once.Do(func() {
+		if d.SpecFunc == nil {
+			result.err = fmt.Errorf("deferred spec has no SpecFunc")
+			return
+		}
+
+		result.spec, result.err = d.SpecFunc(project)
+		if result.err == nil && result.spec == nil {
+			result.err = fmt.Errorf("deferred spec resolved to nil")
+		}
+	})
+
+	return result.spec, result.err
+}
+
+// drop the result for the project, so the spec is resolved again on next use
+func (d *DeferredSpec) Forget(project *Project) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	d.spec = Ptr(d.SpecFunc())
+	delete(d.resolved, project.original())
 }
 
 func (d *DeferredSpec) Check(project *Project) (bool, error) {
-	d.init()
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return false, err
+	}
+	return spec.Check(project)
+}
 
-	if d.spec == nil {
-		return false, fmt.Errorf("unable to initialize deferred spec")
+func (d *DeferredSpec) Apply(project *Project) error {
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return err
 	}
+	return spec.Apply(project)
+}
 
-	return (*d.spec).Check(project)
+func (d *DeferredSpec) Diff(project *Project) (string, error) {
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return "", err
+	}
+	return specDiff(project, spec)
 }
 
-func (d *DeferredSpec) Apply(project *Project) error {
-	d.init()
+func (d *DeferredSpec) Exists(project *Project) (bool, error) {
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return false, err
+	}
+	return specExists(project, spec)
+}
+
+func (d *DeferredSpec) Remove(project *Project) error {
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return err
+	}
+	return specRemove(project, spec)
+}
 
-	if d.spec == nil {
-		return fmt.Errorf("unable to initialize deferred spec")
+func (d *DeferredSpec) Equals(project *Project) (bool, error) {
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return false, err
 	}
+	return specEquals(project, spec)
+}
 
-	return (*d.spec).Apply(project)
+func (d *DeferredSpec) Replace(project *Project) error {
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return err
+	}
+	return specReplace(project, spec)
+}
+
+func (d *DeferredSpec) Snapshot(project *Project) (Snapshot, error) {
+	spec, err := d.Resolve(project)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotSpec(project, spec)
 }
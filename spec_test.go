@@ -1,7 +1,11 @@
 package spec
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -10,12 +14,10 @@ func TestRegisterSpec(t *testing.T) {
 		return &TestSpec{}, nil
 	}
 
-	RegisterSpec("test-spec", testFactory)
+	RegisterSpec("test-spec", testFactory, WithSpecDescription("a test spec"))
+	defer Specs().Unregister("test-spec")
 
-	specRegistry.lock.RLock()
-	defer specRegistry.lock.RUnlock()
-
-	factory, ok := specRegistry.specs["test-spec"]
+	factory, ok := Specs().Get("test-spec")
 	if !ok {
 		t.Fatal("spec not found in registry")
 	}
@@ -24,12 +26,77 @@ func TestRegisterSpec(t *testing.T) {
 		t.Fatal("factory is nil")
 	}
 
-	// clean up - need write lock
-	specRegistry.lock.RUnlock()
-	specRegistry.lock.Lock()
-	delete(specRegistry.specs, "test-spec")
-	specRegistry.lock.Unlock()
-	specRegistry.lock.RLock()
+	t.Run("info", func(t *testing.T) {
+		info, ok := Specs().Info("test-spec")
+		if !ok {
+			t.Fatal("expected spec info")
+		}
+
+		if info.Description != "a test spec" || info.ConfigType != nil {
+			t.Fatalf("unexpected info %+v", info)
+		}
+
+		if info.Package != "github.com/jheddings/go-spec" {
+			t.Fatalf("expected the registering package, got %q", info.Package)
+		}
+	})
+
+	t.Run("unregister", func(t *testing.T) {
+		RegisterSpec("unregister-spec", testFactory)
+
+		if !Specs().Unregister("unregister-spec") {
+			t.Fatal("expected spec to be unregistered")
+		}
+
+		if Specs().Has("unregister-spec") || slices.Contains(ListSpecs(), "unregister-spec") {
+			t.Fatal("expected spec to be removed")
+		}
+
+		if Specs().Unregister("unregister-spec") {
+			t.Fatal("expected second unregister to report a missing spec")
+		}
+	})
+}
+
+func TestRegisterSpecType(t *testing.T) {
+	RegisterSpecType[TestSpec]("typed-test-spec", WithSpecDescription("a typed test spec"))
+	defer Specs().Unregister("typed-test-spec")
+
+	info, ok := Specs().Info("typed-test-spec")
+	if !ok {
+		t.Fatal("expected spec info")
+	}
+
+	if info.ConfigType != reflect.TypeFor[TestSpec]() || info.Package != "github.com/jheddings/go-spec" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	if kind, ok := SpecKind(&TestSpec{}); !ok || kind != "typed-test-spec" {
+		t.Fatalf("expected spec kind, got %q", kind)
+	}
+
+	Specs().Unregister("typed-test-spec")
+	if _, ok := SpecKind(&TestSpec{}); ok {
+		t.Fatal("expected spec kind to be removed with the spec")
+	}
+}
+
+func TestSpecInfos(t *testing.T) {
+	infos := Specs().Infos()
+
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+
+	if !slices.IsSorted(names) || !slices.Equal(names, ListSpecs()) {
+		t.Fatalf("expected infos sorted by name, got %v", names)
+	}
+
+	info, ok := Specs().Info("envfile")
+	if !ok || info.Description == "" || info.ConfigType != reflect.TypeFor[EnvFileSpec]() {
+		t.Fatalf("unexpected built-in info %+v", info)
+	}
 }
 
 func TestCreateSpec(t *testing.T) {
@@ -52,10 +119,7 @@ func TestCreateSpec(t *testing.T) {
 			t.Fatal("expected TestModeSpec")
 		}
 
-		// clean up
-		specRegistry.lock.Lock()
-		delete(specRegistry.specs, "create-test-spec")
-		specRegistry.lock.Unlock()
+		Specs().Unregister("create-test-spec")
 	})
 
 	t.Run("create non-existent spec", func(t *testing.T) {
@@ -89,21 +153,16 @@ func TestCreateSpec(t *testing.T) {
 			t.Fatal("expected nil spec")
 		}
 
-		// clean up
-		specRegistry.lock.Lock()
-		delete(specRegistry.specs, "error-spec")
-		specRegistry.lock.Unlock()
+		Specs().Unregister("error-spec")
 	})
 }
 
 func TestDeferredSpec(t *testing.T) {
 	t.Run("deferred spec check", func(t *testing.T) {
 		testSpec := &TestSpec{}
-		deferred := &DeferredSpec{
-			SpecFunc: func() Specification {
-				return testSpec
-			},
-		}
+		deferred := Defer(func(project *Project) (Specification, error) {
+			return testSpec, nil
+		})
 
 		project := NewProject("test").Build()
 
@@ -123,11 +182,9 @@ func TestDeferredSpec(t *testing.T) {
 
 	t.Run("deferred spec apply", func(t *testing.T) {
 		testSpec := &TestSpec{}
-		deferred := &DeferredSpec{
-			SpecFunc: func() Specification {
-				return testSpec
-			},
-		}
+		deferred := Defer(func(project *Project) (Specification, error) {
+			return testSpec, nil
+		})
 
 		project := NewProject("test").Build()
 
@@ -140,4 +197,164 @@ func TestDeferredSpec(t *testing.T) {
 			t.Fatal("underlying spec Apply was not called")
 		}
 	})
+
+	t.Run("resolved once per project", func(t *testing.T) {
+		calls := map[string]int{}
+		deferred := Defer(func(project *Project) (Specification, error) {
+			calls[project.Name]++
+			return &TestSpec{}, nil
+		})
+
+		first := NewProject("first").WithSpec(deferred).Build()
+		second := NewProject("second").WithSpec(deferred).Build()
+
+		// each run checks and applies the spec
+		for _, project := range []*Project{first, second, first} {
+			if err := project.BuildAll(); err != nil {
+				t.Fatalf("BuildAll failed: %v", err)
+			}
+		}
+
+		if calls["first"] != 1 || calls["second"] != 1 {
+			t.Fatalf("expected one resolution per project, got %v", calls)
+		}
+
+		spec, _ := deferred.Resolve(first)
+		if other, _ := deferred.Resolve(second); spec == other {
+			t.Fatal("expected a separate spec for each project")
+		}
+	})
+
+	t.Run("resolved once through unrestricted copies", func(t *testing.T) {
+		calls := 0
+		deferred := Defer(func(project *Project) (Specification, error) {
+			calls++
+			return &TestSpec{}, nil
+		})
+
+		project := NewProject("unrestricted").WithSpec(Unrestricted(deferred)).Build()
+
+		for range 2 {
+			if err := project.BuildAll(); err != nil {
+				t.Fatalf("BuildAll failed: %v", err)
+			}
+		}
+
+		if calls != 1 || len(deferred.resolved) != 1 {
+			t.Fatalf("expected one resolution, got %d calls and %d results", calls, len(deferred.resolved))
+		}
+	})
+
+	t.Run("forget", func(t *testing.T) {
+		calls := 0
+		deferred := Defer(func(project *Project) (Specification, error) {
+			calls++
+			return &TestSpec{}, nil
+		})
+
+		project := NewProject("forget").Build()
+		for range 2 {
+			if _, err := deferred.Resolve(project); err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			deferred.Forget(project.unrestricted())
+		}
+
+		if calls != 2 || len(deferred.resolved) != 0 {
+			t.Fatalf("expected the result to be dropped, got %d calls and %d results", calls, len(deferred.resolved))
+		}
+	})
+
+	t.Run("project context", func(t *testing.T) {
+		deferred := Defer(func(project *Project) (Specification, error) {
+			return &EnvFileSpec{Path: ".env", Key: "NAME", Value: project.Vars["name"].(string)}, nil
+		})
+
+		project := NewProject("context").WithFS(NewMemFS()).WithVar("name", "demo").WithSpec(deferred).Build()
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		if data, err := fs.ReadFile(project.FS, ".env"); err != nil || string(data) != "NAME=demo\n" {
+			t.Fatalf("expected spec built from project vars, got %q (%v)", data, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		calls := 0
+		failing := Defer(func(project *Project) (Specification, error) {
+			calls++
+			return nil, errTestTransient
+		})
+
+		project := NewProject("test").Build()
+
+		if _, err := failing.Check(project); !errors.Is(err, errTestTransient) {
+			t.Fatalf("expected resolve error from Check, got %v", err)
+		}
+
+		if err := failing.Apply(project); !errors.Is(err, errTestTransient) || calls != 1 {
+			t.Fatalf("expected the same error without resolving again, got %v after %d calls", err, calls)
+		}
+
+		empty := Defer(func(project *Project) (Specification, error) {
+			return nil, nil
+		})
+
+		if err := empty.Apply(project); err == nil {
+			t.Fatal("expected error for a nil spec")
+		}
+
+		if err := (&DeferredSpec{}).Apply(project); err == nil {
+			t.Fatal("expected error without a SpecFunc")
+		}
+	})
+
+	t.Run("modes", func(t *testing.T) {
+		testSpec := &TestSpec{}
+		deferred := Defer(func(project *Project) (Specification, error) {
+			return testSpec, nil
+		})
+
+		project := NewProject("test").Build()
+
+		remove := &RemoveSpec{Spec: deferred}
+		if _, err := remove.Check(project); err != nil || !testSpec.exists {
+			t.Fatalf("expected Exists on the resolved spec (%v)", err)
+		}
+
+		if err := remove.Apply(project); err != nil || !testSpec.remove {
+			t.Fatalf("expected Remove on the resolved spec (%v)", err)
+		}
+
+		replace := &ReplaceSpec{Spec: deferred}
+		if _, err := replace.Check(project); err != nil || !testSpec.equals {
+			t.Fatalf("expected Equals on the resolved spec (%v)", err)
+		}
+
+		if err := replace.Apply(project); err != nil || !testSpec.replace {
+			t.Fatalf("expected Replace on the resolved spec (%v)", err)
+		}
+
+		// specs that support neither fall back to Check, as they do unwrapped
+		plain := Defer(func(project *Project) (Specification, error) {
+			return &TestApplyErrorSpec{}, nil
+		})
+
+		if ok, err := (&RemoveSpec{Spec: plain}).Check(project); err != nil || !ok {
+			t.Fatalf("expected the inverted Check fallback for removal, got %v (%v)", ok, err)
+		}
+
+		if ok, err := (&ReplaceSpec{Spec: plain}).Check(project); err != nil || ok {
+			t.Fatalf("expected the Check fallback for replacement, got %v (%v)", ok, err)
+		}
+
+		if err := plain.Remove(project); err == nil {
+			t.Fatal("expected error for a spec that does not support removal")
+		}
+
+		if err := plain.Replace(project); err == nil {
+			t.Fatal("expected error for a spec that does not support replacement")
+		}
+	})
 }
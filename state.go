@@ -0,0 +1,391 @@
+package spec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// default state file, relative to the project root
+const DefaultStateFile = ".spec/state.json"
+
+// StateStore persists the state of a project between runs.
+type StateStore interface {
+	Load(project *Project) (*State, error)
+	Save(project *Project, state *State) error
+}
+
+// State records the specs that have been applied to a project.
+type State struct {
+	Project string    `json:"project"`
+	Updated time.Time `json:"updated"`
+
+	// applied specs, by spec ID
+	Specs map[string]*SpecState `json:"specs"`
+}
+
+// SpecState records an applied spec, with enough detail to recreate it.
+type SpecState struct {
+	Kind         string         `json:"kind"`
+	Mode         string         `json:"mode,omitempty"`
+	Unrestricted bool           `json:"unrestricted,omitempty"`
+	Config       map[string]any `json:"config,omitempty"`
+
+	// tags of the spec when it was applied; not part of the spec ID
+	Tags []string `json:"tags,omitempty"`
+
+	// when the spec was last applied, and last seen up to date
+	Applied time.Time `json:"applied"`
+	Checked time.Time `json:"checked"`
+}
+
+// IdentifiableSpec is implemented by specs that can name the resource they
+// manage, e.g. a key in a file.  Specs of the same kind and mode that manage
+// the same resource share an ID, so editing a value updates the recorded spec
+// rather than orphaning it.
+type IdentifiableSpec interface {
+	Resource() string
+}
+
+// FileStateStore keeps state in a JSON file for each project.
+type FileStateStore struct {
+	// directory for state files, named after each project; if empty, state
+	// is kept in DefaultStateFile inside each project
+	Dir string
+}
+
+func NewState(project *Project) *State {
+	return &State{Project: project.Name, Specs: make(map[string]*SpecState)}
+}
+
+func NewFileStateStore(dir string) *FileStateStore {
+	return &FileStateStore{Dir: dir}
+}
+
+// load the state of the project; missing state is empty
+func (s *FileStateStore) Load(project *Project) (*State, error) {
+	fsys, name, err := s.resolve(project)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fsys.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewState(project), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := NewState(project)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", name, err)
+	}
+
+	if state.Specs == nil {
+		state.Specs = make(map[string]*SpecState)
+	}
+
+	return state, nil
+}
+
+func (s *FileStateStore) Save(project *Project, state *State) error {
+	fsys, name, err := s.resolve(project)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fsys.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	return fsys.WriteFile(name, append(data, '\n'), 0o644)
+}
+
+func (s *FileStateStore) resolve(project *Project) (WritableFS, string, error) {
+	if s.Dir == "" {
+		return project.ResolveFS(DefaultStateFile)
+	}
+
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return nil, "", err
+	}
+
+	return NewOSFS(s.Dir), url.PathEscape(project.Name) + ".json", nil
+}
+
+// identify a spec using the default registry; see SpecRegistry.ID
+func SpecID(spec Specification) (string, *SpecState, bool) {
+	return defaultRegistry.Specs.ID(spec)
+}
+
+// identify a spec by its kind, mode and resource, or its config for specs
+// that are not an IdentifiableSpec; returns false for specs whose type was
+// not registered with RegisterSpecType
+func (r *SpecRegistry) ID(spec Specification) (string, *SpecState, bool) {
+	state := &SpecState{}
+
+	tags := SpecTags(spec)
+
+	// unwrap modes and options that are recorded alongside the config; retry
+	// policies and tags do not change what a spec manages
+	for done := false; !done; {
+		switch m := spec.(type) {
+		case *EnsureSpec:
+			state.Mode, spec = ModeEnsure, m.Spec
+		case *RemoveSpec:
+			state.Mode, spec = ModeRemove, m.Spec
+		case *ReplaceSpec:
+			state.Mode, spec = ModeReplace, m.Spec
+		case *UnrestrictedSpec:
+			state.Unrestricted, spec = true, m.Spec
+		case *RetrySpec:
+			spec = m.Spec
+		case *TaggedSpec:
+			spec = m.Spec
+		default:
+			done = true
+		}
+	}
+
+	kind, ok := r.Kind(spec)
+	if !ok {
+		return "", nil, false
+	}
+
+	config, err := specConfig(spec)
+	if err != nil {
+		log.Debug().Err(err).Str("spec", kind).Msg("Unable to record spec config")
+		return "", nil, false
+	}
+
+	state.Kind = kind
+	state.Config = config
+
+	identity := any(state)
+	if spec, ok := spec.(IdentifiableSpec); ok {
+		identity = struct {
+			Kind         string
+			Mode         string
+			Unrestricted bool
+			Resource     string
+		}{state.Kind, state.Mode, state.Unrestricted, spec.Resource()}
+	}
+
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return "", nil, false
+	}
+
+	sum := sha256.Sum256(data)
+
+	if len(tags) > 0 {
+		state.Tags = tags
+	}
+
+	return hex.EncodeToString(sum[:]), state, true
+}
+
+// recreate the spec recorded in the state using the default registry
+func (s *SpecState) Spec() (Specification, error) {
+	return s.SpecIn(defaultRegistry)
+}
+
+// recreate the spec recorded in the state
+func (s *SpecState) SpecIn(registry *Registry) (Specification, error) {
+	spec, err := registry.BuildSpec(&SpecConfig{Kind: s.Kind, Mode: s.Mode, Config: s.Config, Tags: s.Tags})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Unrestricted {
+		spec = Unrestricted(spec)
+	}
+
+	return spec, nil
+}
+
+// encode a spec as generic config, using the same field names as config files
+func specConfig(spec Specification) (map[string]any, error) {
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]any{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	// round trip through JSON so the config matches what is loaded from the
+	// state file, which keeps the spec ID stable
+	data, err = json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	config = map[string]any{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// records applied specs in the state store as a project runs
+type stateRecorder struct {
+	BaseObserver
+
+	store StateStore
+
+	lock  sync.Mutex
+	state map[*Project]*State
+
+	// reverts the change recorded for each applied spec, in order, so specs
+	// that are rolled back can be forgotten
+	undo map[*Project][]func(*State)
+}
+
+// use the state store for this run instead of the project's StateStore, e.g.
+// to keep the state of shared projects elsewhere
+func WithStateStore(store StateStore) RunOption {
+	return func(cfg *runConfig) {
+		cfg.state = store
+	}
+}
+
+func (r *stateRecorder) OnProjectStart(project *Project) {
+	state, err := r.store.Load(project)
+	if err != nil {
+		log.Warn().Err(err).Str("project", project.Name).Msg("Unable to load state; starting fresh")
+		state = NewState(project)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.state == nil {
+		r.state = make(map[*Project]*State)
+		r.undo = make(map[*Project][]func(*State))
+	}
+
+	r.state[project] = state
+}
+
+func (r *stateRecorder) OnSpecResult(project *Project, result SpecResult) {
+	if result.Outcome != OutcomeApplied && result.Outcome != OutcomeUpToDate {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	state := r.state[project]
+	if state == nil {
+		return
+	}
+
+	// pruned specs no longer need to be tracked
+	if prune, ok := result.Spec.(*PruneSpec); ok {
+		r.record(project, state, prune.ID, nil, result.Outcome)
+		return
+	}
+
+	id, spec, ok := project.registry().Specs.ID(result.Spec)
+	if !ok {
+		log.Debug().Str("project", project.Name).Type("spec", result.Spec).Msg("Spec kind is not registered; not recording state")
+		if result.Outcome == OutcomeApplied {
+			r.undo[project] = append(r.undo[project], func(*State) {})
+		}
+		return
+	}
+
+	now := time.Now().UTC()
+
+	// specs that were already satisfied are only recorded once applied; the
+	// config is updated, since it may have changed without changing the ID
+	if existing, ok := state.Specs[id]; ok {
+		spec.Applied = existing.Applied
+	} else if result.Outcome != OutcomeApplied {
+		return
+	}
+
+	if result.Outcome == OutcomeApplied {
+		spec.Applied = now
+	}
+
+	spec.Checked = now
+	r.record(project, state, id, spec, result.Outcome)
+}
+
+// forget the state recorded for the most recently applied spec
+func (r *stateRecorder) OnSpecRollback(project *Project, spec Specification, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	undo := r.undo[project]
+	if len(undo) == 0 {
+		return
+	}
+
+	last := undo[len(undo)-1]
+	r.undo[project] = undo[:len(undo)-1]
+
+	// the spec is still applied if it could not be restored
+	if state := r.state[project]; state != nil && err == nil {
+		last(state)
+	}
+}
+
+func (r *stateRecorder) OnProjectEnd(project *Project, err error) {
+	r.lock.Lock()
+	state := r.state[project]
+	delete(r.state, project)
+	delete(r.undo, project)
+	r.lock.Unlock()
+
+	if state == nil {
+		return
+	}
+
+	state.Updated = time.Now().UTC()
+	if err := r.store.Save(project, state); err != nil {
+		log.Error().Err(err).Str("project", project.Name).Msg("Unable to save state")
+	}
+}
+
+// set or delete (if spec is nil) the state of a spec, remembering how to undo
+// the change if the spec was applied; the lock must be held
+func (r *stateRecorder) record(project *Project, state *State, id string, spec *SpecState, outcome Outcome) {
+	if outcome == OutcomeApplied {
+		previous, existed := state.Specs[id]
+		r.undo[project] = append(r.undo[project], func(state *State) {
+			if existed {
+				state.Specs[id] = previous
+			} else {
+				delete(state.Specs, id)
+			}
+		})
+	}
+
+	if spec == nil {
+		delete(state.Specs, id)
+	} else {
+		state.Specs[id] = spec
+	}
+}
@@ -0,0 +1,226 @@
+package spec
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateRecording(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.WriteFile(".env", []byte("A=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewFileStateStore("")
+	existing := &EnvFileSpec{Path: ".env", Key: "A", Value: "1"}
+	created := &EnvFileSpec{Path: ".env", Key: "B", Value: "2"}
+
+	project := NewProject("state").
+		WithFS(fsys).
+		WithStateStore(store).
+		WithSpec(existing).
+		WithSpecPresent(created).
+		WithSpec(&TestSpec{}).
+		Build()
+
+	if err := project.BuildAll(); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	state, err := store.Load(project)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// only the applied spec is recorded; the other was already satisfied and
+	// the test spec has no registered kind
+	if len(state.Specs) != 1 {
+		t.Fatalf("expected 1 recorded spec, got %d", len(state.Specs))
+	}
+
+	id, _, ok := SpecID(&EnsureSpec{Spec: created})
+	if !ok {
+		t.Fatal("expected spec ID")
+	}
+
+	recorded, ok := state.Specs[id]
+	if !ok {
+		t.Fatal("expected applied spec to be recorded by ID")
+	}
+
+	if recorded.Kind != "envfile" || recorded.Mode != ModeEnsure || recorded.Config["key"] != "B" {
+		t.Fatalf("unexpected spec state %+v", recorded)
+	}
+
+	if recorded.Applied.IsZero() || recorded.Checked.IsZero() {
+		t.Fatal("expected timestamps to be recorded")
+	}
+
+	t.Run("rerun keeps applied time", func(t *testing.T) {
+		applied := recorded.Applied
+		time.Sleep(time.Millisecond)
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		state, err := store.Load(project)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+
+		rerun := state.Specs[id]
+		if !rerun.Applied.Equal(applied) {
+			t.Fatal("expected applied time to be unchanged")
+		}
+
+		if !rerun.Checked.After(applied) {
+			t.Fatal("expected checked time to be updated")
+		}
+	})
+
+	t.Run("plan does not record", func(t *testing.T) {
+		before, _ := fsys.ReadFile(DefaultStateFile)
+
+		if _, err := project.Plan(); err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+
+		after, _ := fsys.ReadFile(DefaultStateFile)
+		if string(before) != string(after) {
+			t.Fatal("expected Plan to leave state unchanged")
+		}
+	})
+}
+
+func TestStateStoreOption(t *testing.T) {
+	fsys := NewMemFS()
+	store := NewFileStateStore("")
+	project := NewProject("option").WithFS(fsys).WithSpec(&EnvFileSpec{Path: ".env", Key: "A", Value: "1"}).Build()
+
+	if _, err := project.Plan(WithStateStore(store)); err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	if _, err := fsys.Stat(DefaultStateFile); err == nil {
+		t.Fatal("expected Plan not to record state")
+	}
+
+	if err := project.BuildAll(WithStateStore(store)); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	if state, err := store.Load(project); err != nil || len(state.Specs) != 1 {
+		t.Fatalf("expected the run to record state, got %+v (%v)", state, err)
+	}
+
+	// orphans are found in the store given for the run
+	project.Specs = nil
+	if drift, err := project.Plan(WithStateStore(store), WithPrune()); err != nil || len(drift) != 1 {
+		t.Fatalf("expected an orphan from the run's store, got %d (%v)", len(drift), err)
+	}
+
+	if project.State != nil {
+		t.Fatal("expected the project to be unchanged")
+	}
+}
+
+func TestSpecID(t *testing.T) {
+	spec := &PermissionSpec{Path: "bin", Mode: Ptr(fs.FileMode(0o755)), Recursive: true}
+
+	id, state, ok := SpecID(spec)
+	if !ok {
+		t.Fatal("expected spec ID")
+	}
+
+	t.Run("stable", func(t *testing.T) {
+		again, _, _ := SpecID(&PermissionSpec{Path: "bin", Mode: Ptr(fs.FileMode(0o755)), Recursive: true})
+		if again != id {
+			t.Fatal("expected equal specs to have the same ID")
+		}
+	})
+
+	t.Run("resource changes ID", func(t *testing.T) {
+		other, _, _ := SpecID(&PermissionSpec{Path: "lib", Mode: Ptr(fs.FileMode(0o755)), Recursive: true})
+		if other == id {
+			t.Fatal("expected a different resource to change the ID")
+		}
+	})
+
+	t.Run("values keep ID", func(t *testing.T) {
+		other, state, _ := SpecID(&PermissionSpec{Path: "bin", Mode: Ptr(fs.FileMode(0o700)), Recursive: true})
+		if other != id || state.Config["mode"] != float64(0o700) {
+			t.Fatalf("expected the same resource to keep the ID, got config %v", state.Config)
+		}
+	})
+
+	t.Run("config changes ID without a resource", func(t *testing.T) {
+		exec, _, _ := SpecID(&ExecSpec{ApplyCommand: []string{"true"}})
+		other, _, _ := SpecID(&ExecSpec{ApplyCommand: []string{"false"}})
+		if other == exec {
+			t.Fatal("expected different config to change the ID")
+		}
+	})
+
+	t.Run("mode changes ID", func(t *testing.T) {
+		other, _, _ := SpecID(&RemoveSpec{Spec: spec})
+		if other == id {
+			t.Fatal("expected different mode to change the ID")
+		}
+	})
+
+	t.Run("recreate", func(t *testing.T) {
+		recreated, err := state.Spec()
+		if err != nil {
+			t.Fatalf("Spec failed: %v", err)
+		}
+
+		perm, ok := recreated.(*PermissionSpec)
+		if !ok {
+			t.Fatalf("expected *PermissionSpec, got %T", recreated)
+		}
+
+		if perm.Path != "bin" || *perm.Mode != 0o755 || !perm.Recursive {
+			t.Fatalf("unexpected spec %+v", perm)
+		}
+
+		if again, _, _ := SpecID(recreated); again != id {
+			t.Fatal("expected recreated spec to have the same ID")
+		}
+	})
+
+	t.Run("unregistered kind", func(t *testing.T) {
+		if _, _, ok := SpecID(&TestSpec{}); ok {
+			t.Fatal("expected no ID for unregistered spec")
+		}
+	})
+}
+
+func TestFileStateStoreDir(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStateStore(filepath.Join(dir, "state"))
+	project := NewProject("team/app").WithPath(t.TempDir()).Build()
+
+	state := NewState(project)
+	state.Specs["abc"] = &SpecState{Kind: "exec"}
+
+	if err := store.Save(project, state); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "state", "team%2Fapp.json")); err != nil {
+		t.Fatalf("expected state file named after the project: %v", err)
+	}
+
+	loaded, err := store.Load(project)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loaded.Project != "team/app" || loaded.Specs["abc"].Kind != "exec" {
+		t.Fatalf("unexpected state %+v", loaded)
+	}
+}
@@ -0,0 +1,186 @@
+package spec
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// TaggedSpec adds tags to the wrapped spec, so runs can select specs with a
+// TagFilter.  tags from nested wrappers are combined.
+type TaggedSpec struct {
+	Spec Specification
+	Tags []string
+}
+
+// TagFilter selects specs by their tags.  a spec is selected if it has any of
+// the included tags (or no tags are included) and none of the excluded tags.
+type TagFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// add tags to a spec; tags are added to an existing TaggedSpec rather than
+// wrapping it again
+func Tag(spec Specification, tags ...string) *TaggedSpec {
+	if tagged, ok := spec.(*TaggedSpec); ok {
+		return &TaggedSpec{Spec: tagged.Spec, Tags: mergeTags(tagged.Tags, tags)}
+	}
+	return &TaggedSpec{Spec: spec, Tags: mergeTags(nil, tags)}
+}
+
+// return the sorted tags of a spec, including tags of wrapped specs
+func SpecTags(spec Specification) []string {
+	tags := []string{}
+
+	for spec != nil {
+		switch m := spec.(type) {
+		case *TaggedSpec:
+			tags, spec = mergeTags(tags, m.Tags), m.Spec
+		case *EnsureSpec:
+			spec = m.Spec
+		case *RemoveSpec:
+			spec = m.Spec
+		case *ReplaceSpec:
+			spec = m.Spec
+		case *UnrestrictedSpec:
+			spec = m.Spec
+		case *RetrySpec:
+			spec = m.Spec
+		case *PruneSpec:
+			// orphans keep the tags they were applied with
+			tags, spec = mergeTags(tags, m.State.Tags), nil
+		default:
+			spec = nil
+		}
+	}
+
+	return tags
+}
+
+// select specs with tags in a run; see ParseTagFilter
+func WithTags(filter TagFilter) RunOption {
+	return func(cfg *runConfig) {
+		cfg.tags = &filter
+	}
+}
+
+// parse a comma-separated tag expression, such as "ci,!slow"; tags prefixed
+// with ! are excluded
+func ParseTagFilter(expr string) (TagFilter, error) {
+	filter := TagFilter{}
+	if strings.TrimSpace(expr) == "" {
+		return filter, nil
+	}
+
+	for term := range strings.SplitSeq(expr, ",") {
+		term = strings.TrimSpace(term)
+
+		exclude := strings.HasPrefix(term, "!")
+		tag := strings.TrimSpace(strings.TrimPrefix(term, "!"))
+
+		if err := validateTag(tag); err != nil {
+			return TagFilter{}, fmt.Errorf("invalid tag expression %q: %w", expr, err)
+		}
+
+		if exclude {
+			filter.Exclude = append(filter.Exclude, tag)
+		} else {
+			filter.Include = append(filter.Include, tag)
+		}
+	}
+
+	return filter, nil
+}
+
+// report whether a spec with the given tags is selected
+func (f TagFilter) Match(tags []string) bool {
+	for _, tag := range f.Exclude {
+		if slices.Contains(tags, tag) {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	for _, tag := range f.Include {
+		if slices.Contains(tags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f TagFilter) String() string {
+	terms := slices.Clone(f.Include)
+	for _, tag := range f.Exclude {
+		terms = append(terms, "!"+tag)
+	}
+	return strings.Join(terms, ",")
+}
+
+// return the specs selected by the filter
+func (f TagFilter) filter(specs []Specification) []Specification {
+	selected := []Specification{}
+	for _, spec := range specs {
+		if f.Match(SpecTags(spec)) {
+			selected = append(selected, spec)
+		}
+	}
+	return selected
+}
+
+func validateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("empty tag")
+	}
+
+	if strings.ContainsFunc(tag, func(r rune) bool { return unicode.IsSpace(r) || r == '!' || r == ',' }) {
+		return fmt.Errorf("tag %q may not contain spaces, commas or !", tag)
+	}
+
+	return nil
+}
+
+// combine tags, dropping duplicates and keeping them sorted
+func mergeTags(tags []string, more []string) []string {
+	merged := append(slices.Clone(tags), more...)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+func (t *TaggedSpec) Check(project *Project) (bool, error) {
+	return t.Spec.Check(project)
+}
+
+func (t *TaggedSpec) Apply(project *Project) error {
+	return t.Spec.Apply(project)
+}
+
+func (t *TaggedSpec) Diff(project *Project) (string, error) {
+	return specDiff(project, t.Spec)
+}
+
+func (t *TaggedSpec) Exists(project *Project) (bool, error) {
+	return specExists(project, t.Spec)
+}
+
+func (t *TaggedSpec) Remove(project *Project) error {
+	return specRemove(project, t.Spec)
+}
+
+func (t *TaggedSpec) Equals(project *Project) (bool, error) {
+	return specEquals(project, t.Spec)
+}
+
+func (t *TaggedSpec) Replace(project *Project) error {
+	return specReplace(project, t.Spec)
+}
+
+func (t *TaggedSpec) Snapshot(project *Project) (Snapshot, error) {
+	return snapshotSpec(project, t.Spec)
+}
@@ -0,0 +1,214 @@
+package spec
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTagFilter(t *testing.T) {
+	filter, err := ParseTagFilter("ci, security,!slow")
+	if err != nil {
+		t.Fatalf("ParseTagFilter failed: %v", err)
+	}
+
+	if !slices.Equal(filter.Include, []string{"ci", "security"}) || !slices.Equal(filter.Exclude, []string{"slow"}) {
+		t.Fatalf("unexpected filter %+v", filter)
+	}
+
+	if filter.String() != "ci,security,!slow" {
+		t.Fatalf("unexpected string %q", filter.String())
+	}
+
+	for _, expr := range []string{"ci,", "!", "ci,,slow", "two words", "!!slow"} {
+		if _, err := ParseTagFilter(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+
+	t.Run("match", func(t *testing.T) {
+		tests := []struct {
+			expr string
+			tags []string
+			want bool
+		}{
+			{"", nil, true},
+			{"ci", nil, false},
+			{"ci", []string{"ci"}, true},
+			{"ci,security", []string{"security"}, true},
+			{"!slow", nil, true},
+			{"!slow", []string{"ci", "slow"}, false},
+			{"ci,!slow", []string{"ci", "slow"}, false},
+			{"ci,!slow", []string{"ci"}, true},
+		}
+
+		for _, test := range tests {
+			filter, err := ParseTagFilter(test.expr)
+			if err != nil {
+				t.Fatalf("ParseTagFilter failed: %v", err)
+			}
+
+			if got := filter.Match(test.tags); got != test.want {
+				t.Fatalf("%q matching %v: expected %v, got %v", test.expr, test.tags, test.want, got)
+			}
+		}
+	})
+}
+
+func TestSpecTags(t *testing.T) {
+	spec := Retry(&EnsureSpec{Spec: Tag(Tag(&TestSpec{}, "slow"), "ci", "slow")}, RetryPolicy{})
+
+	if tags := SpecTags(spec); !slices.Equal(tags, []string{"ci", "slow"}) {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	if tags := SpecTags(&TestSpec{}); len(tags) != 0 {
+		t.Fatalf("expected no tags, got %v", tags)
+	}
+
+	t.Run("blueprints", func(t *testing.T) {
+		nested := NewBlueprint("nested").WithTags("slow").WithSpec(&TestSpec{}).Build()
+		bp := NewBlueprint("outer").WithTags("ci").WithSpec(&TestSpec{}).WithBlueprint(*nested).Build()
+
+		project := NewProject("tags").WithBlueprint(*bp).WithSpec(&TestSpec{}).Build()
+
+		expected := [][]string{{"ci"}, {"ci", "slow"}, {}}
+		for idx, spec := range project.Specs {
+			if tags := SpecTags(spec); !slices.Equal(tags, expected[idx]) {
+				t.Fatalf("spec %d: expected tags %v, got %v", idx, expected[idx], tags)
+			}
+		}
+	})
+
+	t.Run("modes without removal or replacement", func(t *testing.T) {
+		plain := Tag(&TestApplyErrorSpec{}, "ci")
+		project := NewProject("plain").Build()
+
+		if ok, err := (&RemoveSpec{Spec: plain}).Check(project); err != nil || !ok {
+			t.Fatalf("expected the inverted Check fallback for removal, got %v (%v)", ok, err)
+		}
+
+		if ok, err := (&ReplaceSpec{Spec: plain}).Check(project); err != nil || ok {
+			t.Fatalf("expected the Check fallback for replacement, got %v (%v)", ok, err)
+		}
+	})
+}
+
+func TestRunTags(t *testing.T) {
+	filter, err := ParseTagFilter("ci,!slow")
+	if err != nil {
+		t.Fatalf("ParseTagFilter failed: %v", err)
+	}
+
+	fast := &TestSpec{}
+	slow := &TestSpec{}
+	untagged := &TestSpec{}
+
+	project := NewProject("tags").
+		WithSpec(Tag(fast, "ci")).
+		WithSpec(Tag(slow, "ci", "slow")).
+		WithSpec(untagged).
+		Build()
+
+	report := NewReport()
+	if err := project.BuildAll(WithTags(filter), WithReport(report)); err != nil {
+		t.Fatalf("BuildAll failed: %v", err)
+	}
+
+	if !fast.apply || slow.check || untagged.check {
+		t.Fatal("expected only the matching spec to run")
+	}
+
+	if len(report.Projects[0].Specs) != 1 {
+		t.Fatalf("expected only the matching spec in the report, got %d", len(report.Projects[0].Specs))
+	}
+
+	drift, err := project.Plan(WithTags(TagFilter{Exclude: []string{"ci"}}))
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	if len(drift) != 1 || drift[0] != untagged {
+		t.Fatal("expected only the untagged spec to be planned")
+	}
+}
+
+func TestTagsConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+blueprints:
+  - name: tags-config-base
+    tags: [security]
+    specs:
+      - kind: envfile
+        config: { path: .env, key: A }
+        tags: [ci]
+        retry: { max_attempts: 2 }
+projects:
+  - name: tags-config
+    blueprints: [tags-config-base]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+
+	registry := NewRegistry()
+	if err := registry.RegisterConfig(config); err != nil {
+		t.Fatalf("RegisterConfig failed: %v", err)
+	}
+
+	project := registry.Projects.Filter(nil)[0]
+	spec := project.Specs[0]
+
+	if tags := SpecTags(spec); !slices.Equal(tags, []string{"ci", "security"}) {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	if policy := project.retryPolicy(spec); policy == nil || policy.MaxAttempts != 2 {
+		t.Fatal("expected the spec retry policy through its tags")
+	}
+
+	t.Run("state", func(t *testing.T) {
+		project.FS = NewMemFS()
+		project.State = NewFileStateStore("")
+
+		if err := project.BuildAll(); err != nil {
+			t.Fatalf("BuildAll failed: %v", err)
+		}
+
+		// tags do not change the spec ID
+		id, _, _ := registry.Specs.ID(spec)
+		if untagged, _, _ := registry.Specs.ID(&EnvFileSpec{Path: ".env", Key: "A"}); id != untagged {
+			t.Fatal("expected tags to be left out of the spec ID")
+		}
+
+		state, err := project.State.Load(project)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+
+		if tags := state.Specs[id].Tags; !slices.Equal(tags, []string{"ci", "security"}) {
+			t.Fatalf("expected tags in the state, got %v", tags)
+		}
+
+		// orphans keep the recorded tags, so they are pruned with their tags
+		project.Specs = nil
+		orphans, err := project.Orphans()
+		if err != nil || len(orphans) != 1 {
+			t.Fatalf("expected 1 orphan, got %d (%v)", len(orphans), err)
+		}
+
+		if len((TagFilter{Include: []string{"security"}}).filter([]Specification{orphans[0]})) != 1 {
+			t.Fatal("expected the orphan to match its tags")
+		}
+
+		if len((TagFilter{Exclude: []string{"ci"}}).filter([]Specification{orphans[0]})) != 0 {
+			t.Fatal("expected the orphan to be excluded by its tags")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		sc := SpecConfig{Kind: "envfile", Tags: []string{"not valid"}}
+		if _, err := registry.BuildSpec(&sc); err == nil {
+			t.Fatal("expected error for invalid tag")
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Workspace is a manifest for many projects: shared vars, labels and default
+// blueprints apply to every project, and overrides adjust the projects
+// matching a selector.  projects may use glob patterns in their path.
+type Workspace struct {
+	// config files with blueprints (and projects) used by the workspace;
+	// relative paths are resolved against the workspace directory
+	Configs []string `yaml:"configs"`
+
+	// defaults for every project; project values take precedence
+	Vars       map[string]any    `yaml:"vars"`
+	Labels     map[string]string `yaml:"labels"`
+	Blueprints []string          `yaml:"blueprints"`
+
+	Projects  []ProjectConfig     `yaml:"projects"`
+	Overrides []WorkspaceOverride `yaml:"overrides"`
+
+	// file the workspace was loaded from, and the directory used to resolve
+	// relative paths
+	path string
+	dir  string
+}
+
+// WorkspaceOverride changes the projects of a workspace matching a selector,
+// e.g. name=api-* or lang=go; overrides are applied in order.
+type WorkspaceOverride struct {
+	Selector   string            `yaml:"selector"`
+	Vars       map[string]any    `yaml:"vars"`
+	Labels     map[string]string `yaml:"labels"`
+	Blueprints []string          `yaml:"blueprints"`
+	Specs      []SpecConfig      `yaml:"specs"`
+	Retry      *RetryPolicy      `yaml:"retry"`
+}
+
+// read a workspace file; relative paths are resolved against its directory
+func LoadWorkspace(path string) (*Workspace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	workspace, err := ParseWorkspace(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	workspace.path = path
+	workspace.dir = filepath.Dir(path)
+
+	return workspace, nil
+}
+
+func ParseWorkspace(data []byte) (*Workspace, error) {
+	workspace := &Workspace{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(workspace); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// load the config files and add the workspace projects to the default
+// registry; see Registry.RegisterWorkspace
+func (w *Workspace) Register() error {
+	return defaultRegistry.registerWorkspace(w, callerPackage(1), callerLocation(1))
+}
+
+// read a workspace file and add its configs and projects to the registry
+func (r *Registry) LoadWorkspace(path string) error {
+	workspace, err := LoadWorkspace(path)
+	if err != nil {
+		return err
+	}
+
+	if err := r.registerWorkspace(workspace, callerPackage(1), path); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// load the config files of the workspace and add its projects to the registry
+func (r *Registry) RegisterWorkspace(workspace *Workspace) error {
+	return r.registerWorkspace(workspace, callerPackage(1), callerLocation(1))
+}
+
+func (r *Registry) registerWorkspace(workspace *Workspace, pkg, location string) error {
+	if workspace.path != "" {
+		location = workspace.path
+	}
+
+	for _, path := range workspace.Configs {
+		path, err := expandPath(path, workspace.dir)
+		if err != nil {
+			return err
+		}
+
+		config, err := LoadConfig(path)
+		if err != nil {
+			return err
+		}
+
+		if err := r.registerConfig(config, pkg, path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	projects, err := r.BuildWorkspace(workspace)
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err := r.Projects.register(project, location); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// build the workspace projects without registering them; blueprints from the
+// workspace configs must already be registered
+func (r *Registry) BuildWorkspace(workspace *Workspace) ([]*Project, error) {
+	configs, err := workspace.ProjectConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	projects := []*Project{}
+	for _, pc := range configs {
+		project, err := r.BuildProject(&pc, workspace.dir)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, nil
+}
+
+// the project configs of the workspace, with glob paths expanded and the
+// defaults and overrides applied
+func (w *Workspace) ProjectConfigs() ([]ProjectConfig, error) {
+	overrides := make([]*Selector, len(w.Overrides))
+	for idx, override := range w.Overrides {
+		selector, err := ParseSelector(override.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("override %d: %w", idx, err)
+		}
+		overrides[idx] = selector
+	}
+
+	configs := []ProjectConfig{}
+	for _, pc := range w.Projects {
+		expanded, err := w.expand(pc)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, config := range expanded {
+			config = w.merge(config)
+
+			// selectors see the project before any overrides; overrides
+			// replace the labels map rather than changing it
+			lookup := configLookup(config.Name, config.Labels)
+			for idx, override := range w.Overrides {
+				if overrides[idx].matches(lookup) {
+					config = override.apply(config)
+				}
+			}
+
+			configs = append(configs, config)
+		}
+	}
+
+	return configs, nil
+}
+
+// expand a project with a glob path to a project for each matching
+// directory, named for the directory
+func (w *Workspace) expand(pc ProjectConfig) ([]ProjectConfig, error) {
+	if !strings.ContainsAny(pc.Path, "*?[") {
+		if pc.Name == "" && pc.Path != "" {
+			pc.Name = filepath.Base(pc.Path)
+		}
+		return []ProjectConfig{pc}, nil
+	}
+
+	if pc.Name != "" {
+		return nil, fmt.Errorf("project %s: a name cannot be used with a glob path", pc.Name)
+	}
+
+	pattern, err := expandPath(pc.Path, w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("project path %s: %w", pc.Path, err)
+	}
+
+	configs := []ProjectConfig{}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err != nil || !info.IsDir() {
+			continue
+		}
+
+		// matches are already resolved against the workspace directory
+		match, err := filepath.Abs(match)
+		if err != nil {
+			return nil, err
+		}
+
+		config := pc
+		config.Name = filepath.Base(match)
+		config.Path = match
+		configs = append(configs, config)
+	}
+
+	if len(configs) == 0 {
+		log.Warn().Str("path", pc.Path).Msg("No project directories match")
+	}
+
+	return configs, nil
+}
+
+// apply the workspace defaults to the project
+func (w *Workspace) merge(pc ProjectConfig) ProjectConfig {
+	pc.Vars = mergeMaps(w.Vars, pc.Vars)
+	pc.Labels = mergeMaps(w.Labels, pc.Labels)
+	pc.Blueprints = mergeNames(w.Blueprints, pc.Blueprints)
+	return pc
+}
+
+func (o *WorkspaceOverride) apply(pc ProjectConfig) ProjectConfig {
+	pc.Vars = mergeMaps(pc.Vars, o.Vars)
+	pc.Labels = mergeMaps(pc.Labels, o.Labels)
+	pc.Blueprints = mergeNames(pc.Blueprints, o.Blueprints)
+	pc.Specs = append(slices.Clip(pc.Specs), o.Specs...)
+
+	if o.Retry != nil {
+		pc.Retry = o.Retry
+	}
+
+	return pc
+}
+
+// look up selector keys in a project config
+func configLookup(name string, labels map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		if key == SelectorName {
+			return name, true
+		}
+		value, ok := labels[key]
+		return value, ok
+	}
+}
+
+// copy base and add the values of other, which take precedence
+func mergeMaps[V any](base, other map[string]V) map[string]V {
+	if base == nil && other == nil {
+		return nil
+	}
+
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = map[string]V{}
+	}
+
+	maps.Copy(merged, other)
+	return merged
+}
+
+// the names in base followed by the names in other that are not in base
+func mergeNames(base, other []string) []string {
+	merged := slices.Clone(base)
+	for _, name := range other {
+		if !slices.Contains(merged, name) {
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
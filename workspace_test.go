@@ -0,0 +1,139 @@
+package spec
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+const testWorkspace = `
+configs: [blueprints.yaml]
+vars: { org: acme, env: dev }
+labels: { owner: platform }
+blueprints: [ws-base]
+projects:
+  - path: services/*
+    labels: { kind: service }
+  - name: ws-web
+    path: web
+    vars: { env: prod }
+    blueprints: [ws-extra]
+overrides:
+  - selector: name=api
+    vars: { port: 8080 }
+    labels: { tier: "1" }
+    blueprints: [ws-extra]
+  - selector: kind=service,tier=1
+    vars: { port: 9090 }
+  - selector: owner=platform
+    specs:
+      - kind: envfile
+        config: { path: .env, key: OVERRIDE, value: "1" }
+`
+
+const testWorkspaceBlueprints = `
+blueprints:
+  - name: ws-base
+    specs:
+      - kind: envfile
+        config: { path: .env, key: ORG, var: org }
+  - name: ws-extra
+    specs:
+      - kind: envfile
+        config: { path: .env, key: EXTRA, value: "1" }
+`
+
+func TestLoadWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTreeAt(t, dir, map[string]string{
+		"workspace.yaml":      testWorkspace,
+		"blueprints.yaml":     testWorkspaceBlueprints,
+		"services/api/go.mod": "module example.com/api\n",
+		"services/db/go.mod":  "module example.com/db\n",
+		"services/README":     "not a project\n",
+		"web/package.json":    "{}\n",
+	})
+
+	registry := NewRegistry()
+	if err := registry.LoadWorkspace(filepath.Join(dir, "workspace.yaml")); err != nil {
+		t.Fatalf("LoadWorkspace failed: %v", err)
+	}
+
+	if !registry.Blueprints.Has("ws-base") {
+		t.Fatal("expected blueprints from the workspace configs")
+	}
+
+	projects := registry.Projects.Filter(nil)
+	if len(projects) != 3 {
+		t.Fatalf("expected 3 projects, got %d", len(projects))
+	}
+
+	api, db, web := projects[0], projects[1], projects[2]
+	if api.Name != "api" || db.Name != "db" || web.Name != "ws-web" {
+		t.Fatalf("unexpected projects %s, %s, %s", api.Name, db.Name, web.Name)
+	}
+
+	if api.Path != filepath.Join(dir, "services", "api") || web.Path != filepath.Join(dir, "web") {
+		t.Fatalf("expected paths in the workspace directory, got %s and %s", api.Path, web.Path)
+	}
+
+	// overrides see the project before earlier overrides, so tier does not
+	// select the second override
+	if api.Vars["org"] != "acme" || api.Vars["port"] != 8080 || api.Labels["tier"] != "1" || api.Labels["owner"] != "platform" {
+		t.Fatalf("unexpected api vars %v and labels %v", api.Vars, api.Labels)
+	}
+
+	if web.Vars["env"] != "prod" || db.Vars["env"] != "dev" || db.Vars["port"] != nil {
+		t.Fatalf("expected project vars to take precedence, got %v and %v", web.Vars, db.Vars)
+	}
+
+	// base, extra and the override spec for api; base and the override spec
+	// for db; base and extra for web, which has the override spec too
+	for project, count := range map[*Project]int{api: 3, db: 2, web: 3} {
+		if len(project.Specs) != count {
+			t.Fatalf("expected %d specs for %s, got %d", count, project.Name, len(project.Specs))
+		}
+	}
+
+	registry.SetDuplicatePolicy(DuplicateError)
+
+	var dup *DuplicateNameError
+	err := registry.Projects.Register(NewProject("api").Build())
+	if !errors.As(err, &dup) || dup.Existing != filepath.Join(dir, "workspace.yaml") {
+		t.Fatalf("expected projects registered at the workspace file, got %v", err)
+	}
+}
+
+func TestWorkspaceErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":     "unknown: field\n",
+		"named glob":        "projects:\n  - name: many\n    path: services/*\n",
+		"bad selector":      "projects:\n  - name: a\noverrides:\n  - selector: \"lang in (go\"\n",
+		"missing name":      "projects:\n  - description: nameless\n",
+		"missing config":    "configs: [missing.yaml]\n",
+		"unknown blueprint": "projects:\n  - name: a\n    blueprints: [ws-missing]\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestTreeAt(t, dir, map[string]string{"workspace.yaml": content})
+
+			if err := NewRegistry().LoadWorkspace(filepath.Join(dir, "workspace.yaml")); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	t.Run("no matches", func(t *testing.T) {
+		workspace, err := ParseWorkspace([]byte("projects:\n  - path: " + t.TempDir() + "/*\n"))
+		if err != nil {
+			t.Fatalf("ParseWorkspace failed: %v", err)
+		}
+
+		configs, err := workspace.ProjectConfigs()
+		if err != nil || len(configs) != 0 {
+			t.Fatalf("expected no projects, got %d (%v)", len(configs), err)
+		}
+	})
+}